@@ -0,0 +1,240 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	minAdminTokenLength = 16
+	maxNoticeLength     = 500
+)
+
+// serverReady is set once the server has loaded its data and restored its
+// rooms, and cleared again as soon as it starts shutting down.
+var serverReady atomic.Bool
+
+type AdminPlayer struct {
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	Connected bool   `json:"connected"`
+	IsHost    bool   `json:"isHost"`
+	BotLevel  string `json:"botLevel,omitempty"`
+	Address   string `json:"address,omitempty"`
+}
+
+type AdminRoom struct {
+	Code        string          `json:"code"`
+	GameType    string          `json:"gameType"`
+	Players     []AdminPlayer   `json:"players"`
+	Public      bool            `json:"public"`
+	HasPassword bool            `json:"hasPassword"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	AgeSeconds  int             `json:"ageSeconds"`
+	State       json.RawMessage `json:"state"`
+}
+
+// AdminRoomDetail adds the game's full internal state, including what players
+// are not shown such as the word to guess.
+type AdminRoomDetail struct {
+	AdminRoom
+	GameState json.RawMessage `json:"gameState"`
+}
+
+type RoomClosedPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type MaintenancePayload struct {
+	Message string `json:"message"`
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !serverReady.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "unavailable"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// requireAdmin only lets through requests carrying the configured admin token
+// as a bearer token. Without a token configured the admin API does not exist.
+func requireAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.AdminToken == "" {
+			writeJSONError(w, http.StatusNotFound, "NOT_FOUND", "The admin API is disabled")
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) != 1 {
+			slog.Warn("Rejected admin request", "remote", r.RemoteAddr, "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeJSONError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Missing or invalid admin token")
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// adminRoom describes the room for the admin API. The game state is encoded
+// right away, while the caller still holds room.mu.
+func (room *GameRoom) adminRoom() AdminRoom {
+	state, _ := json.Marshal(gameStateWithClock(room))
+	info := AdminRoom{
+		Code:        room.Code,
+		GameType:    room.GameType,
+		Players:     make([]AdminPlayer, 0, len(room.Players)),
+		Public:      room.Public,
+		HasPassword: room.Password != nil,
+		CreatedAt:   room.CreatedAt,
+		AgeSeconds:  int(time.Since(room.CreatedAt).Seconds()),
+		State:       state,
+	}
+
+	for client, player := range room.Players {
+		info.Players = append(info.Players, AdminPlayer{
+			Username:  player.Username,
+			Role:      player.Role,
+			Connected: player.Connected,
+			IsHost:    client == room.Host,
+			BotLevel:  player.BotLevel,
+			Address:   client.IP(),
+		})
+	}
+	sort.Slice(info.Players, func(i, j int) bool {
+		return info.Players[i].Username < info.Players[j].Username
+	})
+
+	return info
+}
+
+// handleAdminRooms serves GET /api/admin/rooms.
+func handleAdminRooms(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Use GET")
+		return
+	}
+
+	roomsMu.Lock()
+	open := make([]*GameRoom, 0, len(rooms))
+	for _, room := range rooms {
+		open = append(open, room)
+	}
+	roomsMu.Unlock()
+
+	list := make([]AdminRoom, 0, len(open))
+	for _, room := range open {
+		room.mu.Lock()
+		list = append(list, room.adminRoom())
+		room.mu.Unlock()
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleAdminRoom serves GET and DELETE /api/admin/rooms/{code}: inspecting a
+// room and closing it.
+func handleAdminRoom(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimPrefix(r.URL.Path, "/api/admin/rooms/")
+
+	switch r.Method {
+	case http.MethodGet:
+		roomsMu.Lock()
+		room := rooms[code]
+		roomsMu.Unlock()
+
+		if room == nil {
+			writeJSONError(w, http.StatusNotFound, ErrRoomNotFound, fmt.Sprintf("Room %s not found", code))
+			return
+		}
+
+		// Encode under the lock, but leave the room before writing to a
+		// client that may be slow.
+		room.mu.Lock()
+		detail := AdminRoomDetail{AdminRoom: room.adminRoom()}
+		detail.GameState, _ = json.Marshal(room.GameState)
+		room.mu.Unlock()
+
+		writeJSON(w, http.StatusOK, detail)
+
+	case http.MethodDelete:
+		if !closeRoom(code) {
+			writeJSONError(w, http.StatusNotFound, ErrRoomNotFound, fmt.Sprintf("Room %s not found", code))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Use GET or DELETE")
+	}
+}
+
+// closeRoom shuts the room down on an administrator's orders, telling
+// everyone in it. It returns false when no room has that code.
+func closeRoom(code string) bool {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+
+	room := rooms[code]
+	if room == nil {
+		return false
+	}
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	room.sendAll(newMessage("roomClosed", RoomClosedPayload{
+		Code:    code,
+		Message: "This room was closed by an administrator",
+	}))
+	deleteRoom(room)
+
+	slog.Info("Room closed by an administrator", "room", code)
+	return true
+}
+
+// handleAdminBroadcast serves POST /api/admin/broadcast, which sends a
+// maintenance notice to every connected client.
+func handleAdminBroadcast(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Use POST")
+		return
+	}
+
+	var notice MaintenancePayload
+	if err := json.NewDecoder(r.Body).Decode(&notice); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "BAD_REQUEST", "Body must be a JSON object with a message")
+		return
+	}
+	notice.Message = strings.TrimSpace(notice.Message)
+	if notice.Message == "" || utf8.RuneCountInString(notice.Message) > maxNoticeLength {
+		writeJSONError(w, http.StatusBadRequest, "BAD_REQUEST", fmt.Sprintf("Message must be 1 to %d characters", maxNoticeLength))
+		return
+	}
+
+	recipients := connectedClients()
+	for _, client := range recipients {
+		client.Send(newMessage("maintenance", notice))
+	}
+
+	slog.Info("Broadcast maintenance notice", "recipients", len(recipients), "message", notice.Message)
+	writeJSON(w, http.StatusOK, map[string]int{"recipients": len(recipients)})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// blockingWriter stands in for a slow admin client: every write waits until
+// the test lets it through.
+type blockingWriter struct {
+	*httptest.ResponseRecorder
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	close(w.writing)
+	<-w.release
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestAdminRoomWritesAfterUnlocking(t *testing.T) {
+	room := newTestRoom(t, GameTypeDots)
+	registerTestRoom(t, room)
+
+	w := &blockingWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		writing:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handleAdminRoom(w, httptest.NewRequest(http.MethodGet, "/api/admin/rooms/"+room.Code, nil))
+	}()
+
+	<-w.writing
+	if !room.mu.TryLock() {
+		close(w.release)
+		t.Fatal("room.mu is held while the response is written")
+	}
+	room.mu.Unlock()
+	close(w.release)
+	<-done
+
+	var detail struct {
+		Code      string          `json:"code"`
+		Players   []AdminPlayer   `json:"players"`
+		State     json.RawMessage `json:"state"`
+		GameState json.RawMessage `json:"gameState"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &detail); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body.String(), err)
+	}
+	if detail.Code != room.Code || len(detail.Players) != 2 {
+		t.Errorf("got room %s with %d players, want %s with 2", detail.Code, len(detail.Players), room.Code)
+	}
+	if len(detail.State) == 0 || string(detail.State) == "null" || len(detail.GameState) == 0 || string(detail.GameState) == "null" {
+		t.Errorf("game state missing from %s", w.Body.String())
+	}
+}
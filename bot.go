@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+const (
+	BotEasy   = "easy"
+	BotMedium = "medium"
+	BotHard   = "hard"
+)
+
+// BotGame is implemented by games a computer opponent can play.
+type BotGame interface {
+	Game
+	// BotMove returns the message the bot sitting in role would send at the
+	// given level, or false when it is not role's turn.
+	BotMove(role, level string) (Message, bool)
+}
+
+// newBotClient returns the Client a bot sits behind. Messages sent to it are
+// discarded; the bot reads the game state directly.
+func newBotClient() *Client {
+	return newDetachedClient()
+}
+
+// addBot seats a computer opponent in the room's next free role. The caller
+// holds room.mu.
+func addBot(room *GameRoom, level string) error {
+	if _, ok := room.GameState.(BotGame); !ok {
+		return fmt.Errorf("%s has no computer opponent", room.GameType)
+	}
+
+	switch level {
+	case BotEasy, BotMedium, BotHard:
+	case "":
+		level = BotMedium
+	default:
+		return fmt.Errorf("unknown difficulty %s", level)
+	}
+
+	role := room.nextFreeRole()
+	if role == "" {
+		return fmt.Errorf("room %s has no free seat", room.Code)
+	}
+
+	bot := newBotClient()
+	room.Players[bot] = &Player{
+		Conn:      bot,
+		Username:  fmt.Sprintf("Computer (%s)", level),
+		Role:      role,
+		Connected: true,
+		BotLevel:  level,
+	}
+	return nil
+}
+
+// playBotTurns lets every bot in the room move for as long as it is its turn.
+// Moves go through applyMove exactly like a player's. The caller holds room.mu.
+func (room *GameRoom) playBotTurns() {
+	game, ok := room.GameState.(BotGame)
+	if !ok {
+		return
+	}
+
+	for _, player := range room.Players {
+		if player.BotLevel == "" {
+			continue
+		}
+
+		for !game.IsOver() {
+			msg, ok := game.BotMove(player.Role, player.BotLevel)
+			if !ok {
+				break
+			}
+			if err := room.applyMove(player, msg); err != nil {
+				slog.Error("Bot move rejected", "room", room.Code, "game", room.GameType, "level", player.BotLevel, "err", err)
+				break
+			}
+		}
+	}
+}
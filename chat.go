@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	chatHistorySize = 50
+	maxChatLength   = 300
+
+	// Each connection may send chatBurst messages at once, then one every
+	// 1/chatRate seconds. See messageRateLimits.
+	chatBurst = 5
+	chatRate  = 0.5
+)
+
+type ChatMessage struct {
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	Text     string    `json:"text"`
+	Time     time.Time `json:"time"`
+}
+
+type ChatHistoryPayload struct {
+	Messages []ChatMessage `json:"messages"`
+}
+
+var (
+	chatFilter   *regexp.Regexp
+	chatFilterMu sync.RWMutex
+)
+
+// loadChatFilter reads the words to mask in chat, one per line, from path.
+// Blank lines and lines starting with # are skipped. A missing file leaves
+// chat unfiltered.
+func loadChatFilter(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		words = append(words, regexp.QuoteMeta(word))
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	setChatFilter(words)
+	return nil
+}
+
+// setChatFilter masks the given regexp-quoted words, matched as whole words
+// and ignoring case.
+func setChatFilter(words []string) {
+	var filter *regexp.Regexp
+	if len(words) > 0 {
+		filter = regexp.MustCompile(`(?i)\b(` + strings.Join(words, "|") + `)\b`)
+	}
+
+	chatFilterMu.Lock()
+	chatFilter = filter
+	chatFilterMu.Unlock()
+}
+
+func filterChat(text string) string {
+	chatFilterMu.RLock()
+	filter := chatFilter
+	chatFilterMu.RUnlock()
+
+	if filter == nil {
+		return text
+	}
+	return filter.ReplaceAllStringFunc(text, func(word string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(word))
+	})
+}
+
+func handleChat(ws *Client, msg Message) {
+	var payload struct {
+		Text string `json:"text"`
+	}
+	if err := msg.decodePayload(&payload); err != nil {
+		sendError(ws, ErrBadMessage, "Invalid chat payload")
+		return
+	}
+
+	text := strings.TrimSpace(payload.Text)
+	if text == "" {
+		return
+	}
+	if utf8.RuneCountInString(text) > maxChatLength {
+		sendError(ws, ErrChatTooLong, fmt.Sprintf("Chat messages can be at most %d characters", maxChatLength))
+		return
+	}
+
+	room := findPlayerRoom(ws)
+	if room == nil {
+		sendError(ws, ErrNotInRoom, "You are not in a room")
+		return
+	}
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	player, ok := room.Players[ws]
+	if !ok {
+		sendError(ws, ErrNotInRoom, "You are not in a room")
+		return
+	}
+
+	chat := ChatMessage{
+		Username: player.Username,
+		Role:     player.Role,
+		Text:     filterChat(text),
+		Time:     time.Now(),
+	}
+
+	room.Chat = append(room.Chat, chat)
+	if len(room.Chat) > chatHistorySize {
+		room.Chat = room.Chat[len(room.Chat)-chatHistorySize:]
+	}
+
+	room.sendAll(newMessage("chat", chat))
+}
+
+// sendChatHistory catches ws up on the room's recent chat. The caller holds
+// room.mu.
+func sendChatHistory(ws *Client, room *GameRoom) {
+	messages := make([]ChatMessage, len(room.Chat))
+	copy(messages, room.Chat)
+	ws.Send(newMessage("chatHistory", ChatHistoryPayload{Messages: messages}))
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	sendBufferSize = 64
+)
+
+// Client wraps a websocket connection with an outbound queue. gorilla/websocket
+// allows a single concurrent writer per connection, so every write, including
+// pings, goes through the goroutine started by newClient.
+type Client struct {
+	id        uint64
+	conn      *websocket.Conn
+	send      chan Message
+	done      chan struct{}
+	stopped   chan struct{} // closed once the write goroutine has finished
+	closeOnce sync.Once
+
+	limiter *messageLimiter // only used by the connection's read loop
+	strikes *tokenBucket
+
+	logMu      sync.Mutex
+	baseLogger *slog.Logger // tagged with the connection
+	roomLogger *slog.Logger // also tagged with the room and username, if any
+}
+
+// clients holds every open connection so the server can reach them all, for
+// instance to announce a shutdown.
+var (
+	clients   = make(map[*Client]bool)
+	clientsMu sync.Mutex
+
+	lastClientID atomic.Uint64
+)
+
+func newClient(conn *websocket.Conn) *Client {
+	id := lastClientID.Add(1)
+	c := &Client{
+		id:      id,
+		conn:    conn,
+		send:    make(chan Message, sendBufferSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+
+		limiter:    newMessageLimiter(1),
+		strikes:    newTokenBucket(maxRateStrikes, strikeRecovery),
+		baseLogger: slog.With("conn", id, "remote", conn.RemoteAddr().String()),
+	}
+
+	clientsMu.Lock()
+	clients[c] = true
+	clientsMu.Unlock()
+
+	go c.writePump()
+	return c
+}
+
+// newDetachedClient returns a Client with no connection behind it. Messages
+// sent to it are discarded.
+func newDetachedClient() *Client {
+	c := &Client{done: make(chan struct{})}
+	c.Close()
+	return c
+}
+
+// logger returns the logger for everything concerning this client. Clients
+// without a connection log through the default logger.
+func (c *Client) logger() *slog.Logger {
+	c.logMu.Lock()
+	defer c.logMu.Unlock()
+
+	switch {
+	case c.roomLogger != nil:
+		return c.roomLogger
+	case c.baseLogger != nil:
+		return c.baseLogger
+	default:
+		return slog.Default()
+	}
+}
+
+// msgLogger returns the client's logger tagged with the type of msg.
+func (c *Client) msgLogger(msg Message) *slog.Logger {
+	return c.logger().With("type", msg.Type)
+}
+
+// setLogRoom tags the client's logs with the room it is in and the username
+// it goes by there. An empty code clears both.
+func (c *Client) setLogRoom(code, username string) {
+	c.logMu.Lock()
+	defer c.logMu.Unlock()
+
+	if c.baseLogger == nil {
+		return
+	}
+	if code == "" {
+		c.roomLogger = nil
+		return
+	}
+	c.roomLogger = c.baseLogger.With("room", code, "username", username)
+}
+
+// connectedClients returns a snapshot of every open connection.
+func connectedClients() []*Client {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	list := make([]*Client, 0, len(clients))
+	for c := range clients {
+		list = append(list, c)
+	}
+	return list
+}
+
+// Send queues msg without blocking. A client whose queue is full is too slow
+// to keep up with its room and gets disconnected.
+func (c *Client) Send(msg Message) {
+	select {
+	case <-c.done:
+	case c.send <- msg:
+	default:
+		c.logger().Warn("Send buffer full, disconnecting")
+		c.Close()
+	}
+}
+
+// Close flushes queued messages and closes the connection. It is safe to call
+// more than once and from any goroutine.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+
+		clientsMu.Lock()
+		delete(clients, c)
+		clientsMu.Unlock()
+	})
+}
+
+// closed reports whether the client has been closed.
+func (c *Client) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// RemoteAddr returns the address of the other end of the connection, or ""
+// for a client with no connection.
+func (c *Client) RemoteAddr() string {
+	if c.conn == nil {
+		return ""
+	}
+	return c.conn.RemoteAddr().String()
+}
+
+// IP returns the remote address without its port.
+func (c *Client) IP() string {
+	addr := c.RemoteAddr()
+	if addr == "" {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+func (c *Client) writePump() {
+	ticker := time.NewTicker(config.PingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+		close(c.stopped)
+	}()
+
+	for {
+		select {
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				c.logger().Warn("Write error", "err", err)
+				c.Close()
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.logger().Warn("Ping error", "err", err)
+				c.Close()
+				return
+			}
+		case <-c.done:
+			c.flush()
+			return
+		}
+	}
+}
+
+// flush writes whatever is still queued, then says goodbye.
+func (c *Client) flush() {
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	for {
+		select {
+		case msg := <-c.send:
+			if err := c.conn.WriteJSON(msg); err != nil {
+				return
+			}
+		default:
+			c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	ClockPerMove = "move"  // every turn gets the same fixed allowance
+	ClockTotal   = "clock" // chess style: a bank of time per player plus an increment
+
+	TimeoutLose = "lose"
+	TimeoutSkip = "skip"
+)
+
+// TurnGame is implemented by games where players alternate turns. Only these
+// games can be played with a time control.
+type TurnGame interface {
+	Game
+	// Turn returns the role expected to move next.
+	Turn() string
+	// SkipTurn hands the move to the other player without changing the board.
+	SkipTurn()
+	// Stop finishes the game without a move, for example on timeout.
+	Stop()
+}
+
+// TimeControl is the per-room time limit chosen by the host on create.
+type TimeControl struct {
+	Mode             string `json:"mode"`
+	MoveSeconds      int    `json:"moveSeconds,omitempty"`
+	InitialSeconds   int    `json:"initialSeconds,omitempty"`
+	IncrementSeconds int    `json:"incrementSeconds,omitempty"`
+	OnTimeout        string `json:"onTimeout,omitempty"`
+}
+
+func (tc *TimeControl) validate() error {
+	switch tc.Mode {
+	case ClockPerMove:
+		if tc.MoveSeconds < 5 || tc.MoveSeconds > 3600 {
+			return fmt.Errorf("moveSeconds must be between 5 and 3600")
+		}
+		switch tc.OnTimeout {
+		case "":
+			tc.OnTimeout = TimeoutLose
+		case TimeoutLose, TimeoutSkip:
+		default:
+			return fmt.Errorf("onTimeout must be %s or %s", TimeoutLose, TimeoutSkip)
+		}
+	case ClockTotal:
+		if tc.InitialSeconds < 10 || tc.InitialSeconds > 7200 {
+			return fmt.Errorf("initialSeconds must be between 10 and 7200")
+		}
+		if tc.IncrementSeconds < 0 || tc.IncrementSeconds > 60 {
+			return fmt.Errorf("incrementSeconds must be between 0 and 60")
+		}
+		// Skipping a turn makes no sense once a player's bank is empty.
+		tc.OnTimeout = TimeoutLose
+	default:
+		return fmt.Errorf("mode must be %s or %s", ClockPerMove, ClockTotal)
+	}
+	return nil
+}
+
+// TurnClock tracks the time left for the player to move. All fields are
+// guarded by the owning room's mutex.
+type TurnClock struct {
+	Control   TimeControl
+	Remaining map[string]time.Duration
+	Turn      string
+	TurnStart time.Time
+	timer     *time.Timer
+	seq       int
+}
+
+type ClockPayload struct {
+	Mode        string         `json:"mode"`
+	Turn        string         `json:"turn"`
+	RemainingMs map[string]int `json:"remainingMs"`
+}
+
+type TurnSkippedPayload struct {
+	Player      string `json:"player"`
+	Username    string `json:"username"`
+	CurrentTurn string `json:"currentTurn"`
+}
+
+func newTurnClock(control TimeControl) *TurnClock {
+	return &TurnClock{Control: control, Remaining: make(map[string]time.Duration)}
+}
+
+// resetClock gives every player a fresh allowance and starts timing the
+// player to move. It is called whenever a game starts or restarts.
+func (room *GameRoom) resetClock() {
+	clock := room.Clock
+	if clock == nil {
+		return
+	}
+
+	for _, role := range room.GameState.Roles() {
+		if clock.Control.Mode == ClockTotal {
+			clock.Remaining[role] = time.Duration(clock.Control.InitialSeconds) * time.Second
+		} else {
+			clock.Remaining[role] = time.Duration(clock.Control.MoveSeconds) * time.Second
+		}
+	}
+	clock.Turn = ""
+	room.startTurnTimer()
+}
+
+// advanceClock charges the time spent by the player who just moved and starts
+// timing the next turn.
+func (room *GameRoom) advanceClock() {
+	clock := room.Clock
+	if clock == nil || clock.Turn == "" {
+		return
+	}
+
+	if clock.Control.Mode == ClockTotal {
+		spent := time.Since(clock.TurnStart)
+		clock.Remaining[clock.Turn] += time.Duration(clock.Control.IncrementSeconds)*time.Second - spent
+	}
+	room.startTurnTimer()
+}
+
+func (room *GameRoom) stopClock() {
+	clock := room.Clock
+	if clock == nil {
+		return
+	}
+	if clock.timer != nil {
+		clock.timer.Stop()
+	}
+	clock.seq++
+	clock.Turn = ""
+}
+
+func (room *GameRoom) startTurnTimer() {
+	room.stopClock()
+
+	game, ok := room.GameState.(TurnGame)
+	if !ok || game.IsOver() {
+		return
+	}
+
+	clock := room.Clock
+	clock.Turn = game.Turn()
+	clock.TurnStart = time.Now()
+
+	limit := clock.Remaining[clock.Turn]
+	if clock.Control.Mode == ClockPerMove {
+		limit = time.Duration(clock.Control.MoveSeconds) * time.Second
+		clock.Remaining[clock.Turn] = limit
+	}
+
+	seq := clock.seq
+	clock.timer = time.AfterFunc(limit, func() {
+		room.mu.Lock()
+		defer room.mu.Unlock()
+
+		// A move may have landed while this timer was waiting for the lock.
+		if room.Clock != clock || clock.seq != seq {
+			return
+		}
+		room.handleTimeout()
+	})
+
+	room.sendAll(newMessage("clock", room.clockPayload()))
+}
+
+// handleTimeout applies the room's timeout rule to the player whose time ran
+// out and records it in the match history.
+func (room *GameRoom) handleTimeout() {
+	clock := room.Clock
+	game := room.GameState.(TurnGame)
+	role := clock.Turn
+	clock.Remaining[role] = 0
+
+	if clock.Control.OnTimeout == TimeoutSkip {
+		room.captureEvent("turnSkipped", room.playerForRole(role), nil, func() error {
+			game.SkipTurn()
+			room.sendAll(newMessage("turnSkipped", TurnSkippedPayload{
+				Player:      role,
+				Username:    room.usernameForRole(role),
+				CurrentTurn: game.Turn(),
+			}))
+			room.startTurnTimer()
+			return nil
+		})
+		// Pages only track the turn from moves, so resync them.
+		for client := range room.Players {
+			sendGameState(client, room)
+		}
+		room.playBotTurns()
+		return
+	}
+
+	room.captureEvent("timeout", room.playerForRole(role), nil, func() error {
+		room.stopClock()
+		game.Stop()
+
+		winner := "draw"
+		for _, r := range game.Roles() {
+			if r != role {
+				winner = r
+				break
+			}
+		}
+		room.finishGame(winner, "timeout")
+		return nil
+	})
+}
+
+// clockPayload reports the time left for every role, counting down the
+// player whose turn it is.
+func (room *GameRoom) clockPayload() ClockPayload {
+	clock := room.Clock
+	payload := ClockPayload{
+		Mode:        clock.Control.Mode,
+		Turn:        clock.Turn,
+		RemainingMs: make(map[string]int),
+	}
+	for role, left := range clock.Remaining {
+		if role == clock.Turn {
+			left -= time.Since(clock.TurnStart)
+			if left < 0 {
+				left = 0
+			}
+		}
+		payload.RemainingMs[role] = int(left / time.Millisecond)
+	}
+	return payload
+}
+
+// gameStateWithClock adds the room's clock to the game's own state payload.
+func gameStateWithClock(room *GameRoom) interface{} {
+	state := room.GameState.State()
+	if room.Clock == nil {
+		return state
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return state
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return state
+	}
+	clockJSON, _ := json.Marshal(room.clockPayload())
+	fields["clock"] = clockJSON
+	return fields
+}
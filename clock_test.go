@@ -0,0 +1,144 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newClockedRoom returns a Tic Tac Toe room timed by control, with the game
+// started.
+func newClockedRoom(t *testing.T, control TimeControl) *GameRoom {
+	t.Helper()
+
+	room := newTestRoom(t, GameTypeTicTacToe)
+	room.Clock = newTurnClock(control)
+	t.Cleanup(func() {
+		room.mu.Lock()
+		defer room.mu.Unlock()
+		room.stopClock()
+	})
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	startGame(room)
+	return room
+}
+
+// lastMessage returns the last message of type msgType queued for c.
+func lastMessage(t *testing.T, c *Client, msgType string) (Message, bool) {
+	t.Helper()
+
+	var found Message
+	ok := false
+	for _, msg := range sentMessages(c) {
+		if msg.Type == msgType {
+			found, ok = msg, true
+		}
+	}
+	return found, ok
+}
+
+func TestClockTimeoutLoses(t *testing.T) {
+	room := newClockedRoom(t, TimeControl{Mode: ClockTotal, InitialSeconds: 60, OnTimeout: TimeoutLose})
+
+	room.mu.Lock()
+	room.Clock.Remaining["X"] = 20 * time.Millisecond
+	room.startTurnTimer()
+	room.mu.Unlock()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		room.mu.Lock()
+		over := room.GameState.IsOver()
+		room.mu.Unlock()
+		if over {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("game still running after X ran out of time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	msg, ok := lastMessage(t, room.playerForRole("X").Conn, "gameEnd")
+	if !ok {
+		t.Fatal("no gameEnd message")
+	}
+	var end GameEndPayload
+	if err := msg.decodePayload(&end); err != nil {
+		t.Fatal(err)
+	}
+	if end.Winner != "O" || end.Reason != "timeout" {
+		t.Errorf("got winner %q reason %q, want O on timeout", end.Winner, end.Reason)
+	}
+	if left := room.Clock.Remaining["X"]; left != 0 {
+		t.Errorf("X has %v left, want 0", left)
+	}
+	if room.Clock.Turn != "" {
+		t.Errorf("clock still timing %s after the game ended", room.Clock.Turn)
+	}
+}
+
+func TestClockTimeoutSkips(t *testing.T) {
+	room := newClockedRoom(t, TimeControl{Mode: ClockPerMove, MoveSeconds: 30, OnTimeout: TimeoutSkip})
+	state := room.GameState.(*TicTacToeState)
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	record := room.Record
+	room.handleTimeout()
+
+	if state.IsOver() {
+		t.Fatal("skipping a turn ended the game")
+	}
+	if state.CurrentTurn != "O" {
+		t.Errorf("turn: got %s, want O", state.CurrentTurn)
+	}
+	if state.Board != ([9]string{}) {
+		t.Errorf("board changed: %v", state.Board)
+	}
+	if room.Clock.Turn != "O" {
+		t.Errorf("clock is timing %q, want O", room.Clock.Turn)
+	}
+	if left := room.Clock.Remaining["O"]; left != 30*time.Second {
+		t.Errorf("O has %v, want a fresh 30s", left)
+	}
+
+	msg, ok := lastMessage(t, room.playerForRole("O").Conn, "turnSkipped")
+	if !ok {
+		t.Fatal("no turnSkipped message")
+	}
+	var skipped TurnSkippedPayload
+	if err := msg.decodePayload(&skipped); err != nil {
+		t.Fatal(err)
+	}
+	if skipped.Player != "X" || skipped.CurrentTurn != "O" {
+		t.Errorf("got %+v, want X skipped and O to move", skipped)
+	}
+
+	if n := len(record.Events); n != 1 || record.Events[0].Type != "turnSkipped" {
+		t.Errorf("record events: %+v, want a single turnSkipped", record.Events)
+	}
+}
+
+func TestClockIncrement(t *testing.T) {
+	room := newClockedRoom(t, TimeControl{Mode: ClockTotal, InitialSeconds: 60, IncrementSeconds: 5})
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	if err := room.applyMove(room.playerForRole("X"), newMessage("move", map[string]int{"index": 0})); err != nil {
+		t.Fatal(err)
+	}
+
+	if left := room.Clock.Remaining["X"]; left <= 60*time.Second || left > 65*time.Second {
+		t.Errorf("X has %v after moving, want just under 65s", left)
+	}
+	if room.Clock.Turn != "O" {
+		t.Errorf("clock is timing %q, want O", room.Clock.Turn)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envPrefix is prepended to a setting's flag name, upper-cased with dashes
+// turned into underscores, to get its environment variable: reconnect-grace
+// is read from MINIGAMES_RECONNECT_GRACE.
+const envPrefix = "MINIGAMES_"
+
+type Config struct {
+	Addr            string
+	PublicDir       string
+	DataDir         string
+	ChatFilter      string
+	AdminToken      string
+	LogLevel        string
+	LogFormat       string
+	MaxMessageSize  int64
+	MaxRoomsPerIP   int
+	PongWait        time.Duration
+	PingPeriod      time.Duration
+	ReconnectGrace  time.Duration
+	RestoreGrace    time.Duration
+	EmptyRoomExpiry time.Duration
+	CleanupInterval time.Duration
+}
+
+// config holds the settings the server was started with. It is filled in by
+// loadConfig before anything else runs and never changes afterwards.
+var config = defaultConfig()
+
+func defaultConfig() Config {
+	return Config{
+		Addr:            ":8080",
+		PublicDir:       "./public",
+		DataDir:         "data",
+		ChatFilter:      "chat_filter.txt",
+		LogLevel:        "info",
+		LogFormat:       "text",
+		MaxMessageSize:  4096,
+		MaxRoomsPerIP:   5,
+		PongWait:        60 * time.Second,
+		PingPeriod:      30 * time.Second,
+		ReconnectGrace:  10 * time.Second,
+		RestoreGrace:    time.Minute,
+		EmptyRoomExpiry: 5 * time.Minute,
+		CleanupInterval: time.Minute,
+	}
+}
+
+// loadConfig builds the configuration from, in increasing order of priority,
+// the defaults, an optional JSON config file, MINIGAMES_* environment
+// variables and the command line. The config file is named by -config or
+// MINIGAMES_CONFIG and maps setting names to values, e.g.
+// {"addr": ":9000", "pong-wait": "90s", "max-rooms-per-ip": 10}.
+func loadConfig(args []string) (Config, error) {
+	cfg := defaultConfig()
+
+	fs := flag.NewFlagSet("minigames-server", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv(envPrefix+"CONFIG"), "path to a JSON config file")
+	fs.StringVar(&cfg.Addr, "addr", cfg.Addr, "address to listen on")
+	fs.StringVar(&cfg.PublicDir, "public-dir", cfg.PublicDir, "directory of static files to serve")
+	fs.StringVar(&cfg.DataDir, "data-dir", cfg.DataDir, "directory for match history and ratings")
+	fs.StringVar(&cfg.ChatFilter, "chat-filter", cfg.ChatFilter, "file of words to mask in chat, one per line")
+	fs.StringVar(&cfg.AdminToken, "admin-token", cfg.AdminToken, "bearer token for the admin API, which is disabled when empty")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "lowest level logged: debug, info, warn or error")
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "log output format: text or json")
+	fs.Int64Var(&cfg.MaxMessageSize, "max-message-size", cfg.MaxMessageSize, "largest websocket message accepted, in bytes")
+	fs.IntVar(&cfg.MaxRoomsPerIP, "max-rooms-per-ip", cfg.MaxRoomsPerIP, "most rooms one address may have open at once")
+	fs.DurationVar(&cfg.PongWait, "pong-wait", cfg.PongWait, "how long to wait for a pong before dropping a connection")
+	fs.DurationVar(&cfg.PingPeriod, "ping-period", cfg.PingPeriod, "how often to ping each connection")
+	fs.DurationVar(&cfg.ReconnectGrace, "reconnect-grace", cfg.ReconnectGrace, "how long a disconnected player keeps their seat")
+	fs.DurationVar(&cfg.RestoreGrace, "restore-grace", cfg.RestoreGrace, "how long players have to rejoin rooms restored after a restart")
+	fs.DurationVar(&cfg.EmptyRoomExpiry, "empty-room-expiry", cfg.EmptyRoomExpiry, "how long an empty room is kept before it is removed")
+	fs.DurationVar(&cfg.CleanupInterval, "cleanup-interval", cfg.CleanupInterval, "how often to look for empty rooms")
+
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	fromCommandLine := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		fromCommandLine[f.Name] = true
+	})
+
+	if *configFile != "" {
+		settings, err := readConfigFile(*configFile)
+		if err != nil {
+			return cfg, err
+		}
+		for name, value := range settings {
+			if name == "config" || fs.Lookup(name) == nil {
+				return cfg, fmt.Errorf("%s: unknown setting %q", *configFile, name)
+			}
+			if fromCommandLine[name] {
+				continue
+			}
+			if err := fs.Set(name, value); err != nil {
+				return cfg, fmt.Errorf("%s: invalid value %q for %s: %v", *configFile, value, name, err)
+			}
+		}
+	}
+
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		if envErr != nil || f.Name == "config" || fromCommandLine[f.Name] {
+			return
+		}
+		name := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			envErr = fmt.Errorf("invalid value %q for %s: %v", value, name, err)
+		}
+	})
+	if envErr != nil {
+		return cfg, envErr
+	}
+
+	return cfg, cfg.validate()
+}
+
+// readConfigFile returns the settings in a JSON config file as strings to be
+// parsed like flags. Numbers and booleans may be written as such; durations
+// are strings written the same way as on the command line, e.g. "90s" or "5m".
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	settings := make(map[string]string, len(raw))
+	for name, value := range raw {
+		dec := json.NewDecoder(bytes.NewReader(value))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, name, err)
+		}
+
+		switch v := v.(type) {
+		case string:
+			settings[name] = v
+		case json.Number:
+			settings[name] = v.String()
+		case bool:
+			settings[name] = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf("%s: %s must be a string, a number or a boolean, got %s", path, name, value)
+		}
+	}
+	return settings, nil
+}
+
+func (cfg Config) validate() error {
+	if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+		return fmt.Errorf("invalid addr %q: %v", cfg.Addr, err)
+	}
+	if info, err := os.Stat(cfg.PublicDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("public-dir %q is not a directory", cfg.PublicDir)
+	}
+	if cfg.DataDir == "" {
+		return fmt.Errorf("data-dir must not be empty")
+	}
+	if _, err := parseLogLevel(cfg.LogLevel); err != nil {
+		return err
+	}
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		return fmt.Errorf("log-format must be text or json")
+	}
+	if cfg.MaxMessageSize <= 0 {
+		return fmt.Errorf("max-message-size must be positive")
+	}
+	if cfg.MaxRoomsPerIP <= 0 {
+		return fmt.Errorf("max-rooms-per-ip must be positive")
+	}
+	if cfg.AdminToken != "" && len(cfg.AdminToken) < minAdminTokenLength {
+		return fmt.Errorf("admin-token must be at least %d characters", minAdminTokenLength)
+	}
+
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"pong-wait", cfg.PongWait},
+		{"ping-period", cfg.PingPeriod},
+		{"reconnect-grace", cfg.ReconnectGrace},
+		{"restore-grace", cfg.RestoreGrace},
+		{"empty-room-expiry", cfg.EmptyRoomExpiry},
+		{"cleanup-interval", cfg.CleanupInterval},
+	}
+	for _, d := range durations {
+		if d.value <= 0 {
+			return fmt.Errorf("%s must be positive, got %s", d.name, d.value)
+		}
+	}
+
+	// A ping has to go out, and its pong come back, before the read deadline.
+	if cfg.PingPeriod >= cfg.PongWait {
+		return fmt.Errorf("ping-period (%s) must be shorter than pong-wait (%s)", cfg.PingPeriod, cfg.PongWait)
+	}
+	return nil
+}
+
+func (cfg Config) log() {
+	slog.Info("Config",
+		"addr", cfg.Addr,
+		"publicDir", cfg.PublicDir,
+		"dataDir", cfg.DataDir,
+		"chatFilter", cfg.ChatFilter,
+		"adminAPI", cfg.AdminToken != "",
+		"logLevel", cfg.LogLevel,
+		"logFormat", cfg.LogFormat,
+		"maxMessageSize", cfg.MaxMessageSize,
+		"maxRoomsPerIP", cfg.MaxRoomsPerIP,
+		"pongWait", cfg.PongWait.String(),
+		"pingPeriod", cfg.PingPeriod.String(),
+		"reconnectGrace", cfg.ReconnectGrace.String(),
+		"restoreGrace", cfg.RestoreGrace.String(),
+		"emptyRoomExpiry", cfg.EmptyRoomExpiry.String(),
+		"cleanupInterval", cfg.CleanupInterval.String(),
+	)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFileValues(t *testing.T) {
+	path := writeConfigFile(t, `{
+		"addr": ":9000",
+		"max-rooms-per-ip": 10,
+		"max-message-size": 8192,
+		"pong-wait": "90s",
+		"log-format": "json"
+	}`)
+
+	cfg, err := loadConfig([]string{"-config", path, "-max-rooms-per-ip", "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Addr != ":9000" || cfg.MaxMessageSize != 8192 || cfg.PongWait != 90*time.Second || cfg.LogFormat != "json" {
+		t.Errorf("config file settings not applied: %+v", cfg)
+	}
+	if cfg.MaxRoomsPerIP != 3 {
+		t.Errorf("max-rooms-per-ip is %d, want the command line's 3", cfg.MaxRoomsPerIP)
+	}
+}
+
+func TestReadConfigFile(t *testing.T) {
+	tests := []struct {
+		contents string
+		want     map[string]string
+		err      string
+	}{
+		{`{"addr": ":9000"}`, map[string]string{"addr": ":9000"}, ""},
+		{`{"max-rooms-per-ip": 5}`, map[string]string{"max-rooms-per-ip": "5"}, ""},
+		{`{"max-message-size": 1e4}`, map[string]string{"max-message-size": "1e4"}, ""},
+		{`{"verbose": true}`, map[string]string{"verbose": "true"}, ""},
+		{`{"addr": null}`, nil, "addr must be a string, a number or a boolean"},
+		{`{"addr": [":9000"]}`, nil, "addr must be a string, a number or a boolean"},
+		{`[":9000"]`, nil, "cannot unmarshal"},
+	}
+	for _, tt := range tests {
+		settings, err := readConfigFile(writeConfigFile(t, tt.contents))
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want one mentioning %q", tt.contents, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.contents, err)
+			continue
+		}
+		if len(settings) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.contents, settings, tt.want)
+		}
+		for name, value := range tt.want {
+			if settings[name] != value {
+				t.Errorf("%s: %s is %q, want %q", tt.contents, name, settings[name], value)
+			}
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import "math/rand"
+
+type Connect4State struct {
+	Board       [6][7]string
+	CurrentTurn string
+	GameActive  bool
+}
+
+type Connect4MovePayload struct {
+	Row      int    `json:"row"`
+	Column   int    `json:"column"`
+	Player   string `json:"player"`
+	Username string `json:"username"`
+}
+
+func init() {
+	registerGame(GameTypeConnect4, func() Game {
+		return &Connect4State{
+			Board:       [6][7]string{},
+			CurrentTurn: "Red",
+			GameActive:  true,
+		}
+	})
+}
+
+func (state *Connect4State) Roles() []string {
+	return []string{"Red", "Yellow"}
+}
+
+func (state *Connect4State) MoveTypes() []string {
+	return []string{"connect4Move"}
+}
+
+func (state *Connect4State) State() interface{} {
+	return struct {
+		Board       [6][7]string `json:"board"`
+		CurrentTurn string       `json:"currentTurn"`
+		GameActive  bool         `json:"gameActive"`
+	}{state.Board, state.CurrentTurn, state.GameActive}
+}
+
+func (state *Connect4State) IsOver() bool {
+	return !state.GameActive
+}
+
+func (state *Connect4State) Restart() {
+	*state = Connect4State{
+		Board:       [6][7]string{},
+		CurrentTurn: "Red",
+		GameActive:  true,
+	}
+}
+
+func (state *Connect4State) Turn() string {
+	return state.CurrentTurn
+}
+
+func (state *Connect4State) SkipTurn() {
+	if state.CurrentTurn == "Red" {
+		state.CurrentTurn = "Yellow"
+	} else {
+		state.CurrentTurn = "Red"
+	}
+}
+
+func (state *Connect4State) Stop() {
+	state.GameActive = false
+}
+
+func (state *Connect4State) ApplyMove(room *GameRoom, player *Player, msg Message) error {
+	var move struct {
+		Column int `json:"column"`
+	}
+	if err := msg.decodePayload(&move); err != nil {
+		return errMalformedMove
+	}
+
+	if player.Role != state.CurrentTurn {
+		return errNotYourTurn
+	}
+
+	if move.Column < 0 || move.Column >= 7 {
+		return rejectMove(ErrInvalidMove, "Column must be between 0 and 6")
+	}
+
+	row := -1
+	for r := 5; r >= 0; r-- {
+		if state.Board[r][move.Column] == "" {
+			row = r
+			break
+		}
+	}
+
+	if row == -1 {
+		return rejectMove(ErrInvalidMove, "That column is full")
+	}
+
+	state.Board[row][move.Column] = player.Role
+
+	if state.CurrentTurn == "Red" {
+		state.CurrentTurn = "Yellow"
+	} else {
+		state.CurrentTurn = "Red"
+	}
+
+	room.sendAll(newMessage("connect4Move", Connect4MovePayload{
+		Row:      row,
+		Column:   move.Column,
+		Player:   player.Role,
+		Username: player.Username,
+	}))
+
+	checkConnect4GameEnd(room, state, row, move.Column)
+	return nil
+}
+
+// connect4Wins reports whether the piece at row, col completes four in a row.
+func connect4Wins(board *[6][7]string, row, col int) bool {
+	player := board[row][col]
+
+	directions := [][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+
+	for _, dir := range directions {
+		count := 1
+
+		r, c := row+dir[0], col+dir[1]
+		for r >= 0 && r < 6 && c >= 0 && c < 7 && board[r][c] == player {
+			count++
+			r, c = r+dir[0], c+dir[1]
+		}
+
+		r, c = row-dir[0], col-dir[1]
+		for r >= 0 && r < 6 && c >= 0 && c < 7 && board[r][c] == player {
+			count++
+			r, c = r-dir[0], c-dir[1]
+		}
+
+		if count >= 4 {
+			return true
+		}
+	}
+	return false
+}
+
+func checkConnect4GameEnd(room *GameRoom, state *Connect4State, row, col int) {
+	if connect4Wins(&state.Board, row, col) {
+		state.GameActive = false
+		room.endGame(state.Board[row][col])
+		return
+	}
+
+	for c := 0; c < 7; c++ {
+		if state.Board[0][c] == "" {
+			return
+		}
+	}
+
+	state.GameActive = false
+	room.endGame("draw")
+}
+
+// Search depth of the computer opponent for each difficulty level.
+var connect4BotDepth = map[string]int{
+	BotMedium: 3,
+	BotHard:   7,
+}
+
+// Centre columns take part in more lines, so they are searched first.
+var connect4ColumnOrder = [7]int{3, 2, 4, 1, 5, 0, 6}
+
+const connect4WinScore = 1000000
+
+func connect4DropRow(board *[6][7]string, col int) int {
+	for r := 5; r >= 0; r-- {
+		if board[r][col] == "" {
+			return r
+		}
+	}
+	return -1
+}
+
+func (state *Connect4State) BotMove(role, level string) (Message, bool) {
+	if state.CurrentTurn != role {
+		return Message{}, false
+	}
+
+	var free []int
+	for _, col := range connect4ColumnOrder {
+		if connect4DropRow(&state.Board, col) >= 0 {
+			free = append(free, col)
+		}
+	}
+	if len(free) == 0 {
+		return Message{}, false
+	}
+
+	column := free[rand.Intn(len(free))]
+	if depth, ok := connect4BotDepth[level]; ok {
+		opponent := "Red"
+		if role == "Red" {
+			opponent = "Yellow"
+		}
+
+		board := state.Board
+		best := -connect4WinScore * 2
+		for _, col := range free {
+			row := connect4DropRow(&board, col)
+			board[row][col] = role
+			var score int
+			if connect4Wins(&board, row, col) {
+				score = connect4WinScore + depth
+			} else {
+				score = -connect4Negamax(&board, depth-1, -connect4WinScore*2, connect4WinScore*2, opponent, role)
+			}
+			board[row][col] = ""
+			if score > best {
+				best, column = score, col
+			}
+		}
+	}
+
+	return newMessage("connect4Move", struct {
+		Column int `json:"column"`
+	}{column}), true
+}
+
+// connect4Negamax is an alpha-beta search scoring board for me, who moves
+// next. Quicker wins score higher than slower ones.
+func connect4Negamax(board *[6][7]string, depth, alpha, beta int, me, opponent string) int {
+	if depth <= 0 {
+		return connect4Evaluate(board, me, opponent)
+	}
+
+	best := -connect4WinScore * 2
+	moved := false
+	for _, col := range connect4ColumnOrder {
+		row := connect4DropRow(board, col)
+		if row < 0 {
+			continue
+		}
+		moved = true
+
+		board[row][col] = me
+		var score int
+		if connect4Wins(board, row, col) {
+			score = connect4WinScore + depth
+		} else {
+			score = -connect4Negamax(board, depth-1, -beta, -alpha, opponent, me)
+		}
+		board[row][col] = ""
+
+		if score > best {
+			best = score
+		}
+		if best > alpha {
+			alpha = best
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+
+	if !moved {
+		return 0
+	}
+	return best
+}
+
+// connect4Evaluate scores an unfinished position by counting every window of
+// four cells that only one side can still complete.
+func connect4Evaluate(board *[6][7]string, me, opponent string) int {
+	score := 0
+	for r := 0; r < 6; r++ {
+		if board[r][3] == me {
+			score += 3
+		} else if board[r][3] == opponent {
+			score -= 3
+		}
+	}
+
+	directions := [][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+	for r := 0; r < 6; r++ {
+		for c := 0; c < 7; c++ {
+			for _, dir := range directions {
+				endR, endC := r+3*dir[0], c+3*dir[1]
+				if endR < 0 || endR >= 6 || endC < 0 || endC >= 7 {
+					continue
+				}
+
+				mine, theirs := 0, 0
+				for i := 0; i < 4; i++ {
+					switch board[r+i*dir[0]][c+i*dir[1]] {
+					case me:
+						mine++
+					case opponent:
+						theirs++
+					}
+				}
+
+				if theirs == 0 {
+					score += [4]int{0, 1, 4, 16}[mine]
+				} else if mine == 0 {
+					score -= [4]int{0, 1, 5, 20}[theirs]
+				}
+			}
+		}
+	}
+	return score
+}
@@ -0,0 +1,209 @@
+package main
+
+type DotsState struct {
+	Grid        [4][4]bool
+	Lines       []Line
+	Boxes       [3][3]string
+	CurrentTurn string
+	GameActive  bool
+	Scores      map[string]int
+}
+
+type DotsMovePayload struct {
+	Type        string         `json:"type"`
+	Row         int            `json:"row"`
+	Col         int            `json:"col"`
+	Player      string         `json:"player"`
+	Username    string         `json:"username"`
+	Completed   int            `json:"completed"`
+	Boxes       [3][3]string   `json:"boxes"`
+	Scores      map[string]int `json:"scores"`
+	CurrentTurn string         `json:"currentTurn"`
+}
+
+type Line struct {
+	Type   string `json:"type"`
+	Row    int    `json:"row"`
+	Col    int    `json:"col"`
+	Player string `json:"player"`
+}
+
+func init() {
+	registerGame(GameTypeDots, newDotsState)
+}
+
+func newDotsState() Game {
+	return &DotsState{
+		Grid:        [4][4]bool{},
+		Lines:       []Line{},
+		Boxes:       [3][3]string{},
+		CurrentTurn: "P1",
+		GameActive:  true,
+		Scores:      map[string]int{"P1": 0, "P2": 0},
+	}
+}
+
+func (state *DotsState) Roles() []string {
+	return []string{"P1", "P2"}
+}
+
+func (state *DotsState) MoveTypes() []string {
+	return []string{"dotsMove"}
+}
+
+func (state *DotsState) State() interface{} {
+	return struct {
+		Lines       []Line         `json:"lines"`
+		Boxes       [3][3]string   `json:"boxes"`
+		Scores      map[string]int `json:"scores"`
+		CurrentTurn string         `json:"currentTurn"`
+		GameActive  bool           `json:"gameActive"`
+	}{state.Lines, state.Boxes, state.Scores, state.CurrentTurn, state.GameActive}
+}
+
+func (state *DotsState) IsOver() bool {
+	return !state.GameActive
+}
+
+func (state *DotsState) Restart() {
+	*state = *newDotsState().(*DotsState)
+}
+
+func (state *DotsState) Turn() string {
+	return state.CurrentTurn
+}
+
+func (state *DotsState) SkipTurn() {
+	if state.CurrentTurn == "P1" {
+		state.CurrentTurn = "P2"
+	} else {
+		state.CurrentTurn = "P1"
+	}
+}
+
+func (state *DotsState) Stop() {
+	state.GameActive = false
+}
+
+func (state *DotsState) ApplyMove(room *GameRoom, player *Player, msg Message) error {
+	var move struct {
+		Type string `json:"type"`
+		Row  int    `json:"row"`
+		Col  int    `json:"col"`
+	}
+	if err := msg.decodePayload(&move); err != nil {
+		return errMalformedMove
+	}
+
+	if player.Role != state.CurrentTurn {
+		return errNotYourTurn
+	}
+
+	switch move.Type {
+	case "horizontal":
+		if move.Row < 0 || move.Row > 3 || move.Col < 0 || move.Col > 2 {
+			return rejectMove(ErrInvalidMove, "Line is outside the grid")
+		}
+	case "vertical":
+		if move.Row < 0 || move.Row > 2 || move.Col < 0 || move.Col > 3 {
+			return rejectMove(ErrInvalidMove, "Line is outside the grid")
+		}
+	default:
+		return rejectMove(ErrInvalidMove, "Line type must be horizontal or vertical")
+	}
+
+	if state.hasLine(move.Type, move.Row, move.Col) {
+		return rejectMove(ErrInvalidMove, "That line has already been drawn")
+	}
+
+	state.Lines = append(state.Lines, Line{
+		Type:   move.Type,
+		Row:    move.Row,
+		Col:    move.Col,
+		Player: player.Role,
+	})
+
+	state.Grid[move.Row][move.Col] = true
+	if move.Type == "horizontal" {
+		state.Grid[move.Row][move.Col+1] = true
+	} else {
+		state.Grid[move.Row+1][move.Col] = true
+	}
+
+	// A line can close at most the two boxes on either side of it.
+	var candidates [][2]int
+	if move.Type == "horizontal" {
+		candidates = [][2]int{{move.Row - 1, move.Col}, {move.Row, move.Col}}
+	} else {
+		candidates = [][2]int{{move.Row, move.Col - 1}, {move.Row, move.Col}}
+	}
+
+	completed := 0
+	for _, box := range candidates {
+		r, c := box[0], box[1]
+		if r < 0 || r > 2 || c < 0 || c > 2 || state.Boxes[r][c] != "" {
+			continue
+		}
+		if state.hasLine("horizontal", r, c) &&
+			state.hasLine("horizontal", r+1, c) &&
+			state.hasLine("vertical", r, c) &&
+			state.hasLine("vertical", r, c+1) {
+			state.Boxes[r][c] = player.Role
+			state.Scores[player.Role]++
+			completed++
+		}
+	}
+
+	// Completing a box earns the player another turn.
+	if completed == 0 {
+		if state.CurrentTurn == "P1" {
+			state.CurrentTurn = "P2"
+		} else {
+			state.CurrentTurn = "P1"
+		}
+	}
+
+	room.sendAll(newMessage("dotsMove", DotsMovePayload{
+		Type:        move.Type,
+		Row:         move.Row,
+		Col:         move.Col,
+		Player:      player.Role,
+		Username:    player.Username,
+		Completed:   completed,
+		Boxes:       state.Boxes,
+		Scores:      state.Scores,
+		CurrentTurn: state.CurrentTurn,
+	}))
+
+	checkDotsGameEnd(room, state)
+	return nil
+}
+
+func (state *DotsState) hasLine(lineType string, row, col int) bool {
+	for _, line := range state.Lines {
+		if line.Type == lineType && line.Row == row && line.Col == col {
+			return true
+		}
+	}
+	return false
+}
+
+func checkDotsGameEnd(room *GameRoom, state *DotsState) {
+	for r := 0; r < 3; r++ {
+		for c := 0; c < 3; c++ {
+			if state.Boxes[r][c] == "" {
+				return
+			}
+		}
+	}
+
+	state.GameActive = false
+
+	if state.Scores["P1"] > state.Scores["P2"] {
+		room.endGame("P1")
+	} else if state.Scores["P2"] > state.Scores["P1"] {
+		room.endGame("P2")
+	} else {
+		room.endGame("draw")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import "testing"
+
+type dotsTestMove struct {
+	role     string
+	lineType string
+	row, col int
+}
+
+func dotsMove(lineType string, row, col int) Message {
+	return newMessage("dotsMove", map[string]interface{}{"type": lineType, "row": row, "col": col})
+}
+
+func TestDotsApplyMove(t *testing.T) {
+	tests := []struct {
+		name      string
+		moves     []dotsTestMove
+		wantCode  string // error code of the last move
+		wantTurn  string
+		wantBoxes map[[2]int]string
+		wantScore map[string]int
+		wantLines int
+	}{
+		{
+			name:      "line without a box passes the turn",
+			moves:     []dotsTestMove{{"P1", "horizontal", 0, 0}},
+			wantTurn:  "P2",
+			wantScore: map[string]int{"P1": 0, "P2": 0},
+			wantLines: 1,
+		},
+		{
+			name: "closing a box scores it and keeps the turn",
+			moves: []dotsTestMove{
+				{"P1", "horizontal", 0, 0},
+				{"P2", "horizontal", 1, 0},
+				{"P1", "vertical", 0, 0},
+				{"P2", "vertical", 0, 1},
+			},
+			wantTurn:  "P2",
+			wantBoxes: map[[2]int]string{{0, 0}: "P2"},
+			wantScore: map[string]int{"P1": 0, "P2": 1},
+			wantLines: 4,
+		},
+		{
+			name: "one line can close two boxes",
+			moves: []dotsTestMove{
+				{"P1", "horizontal", 0, 0},
+				{"P2", "horizontal", 1, 0},
+				{"P1", "horizontal", 0, 1},
+				{"P2", "horizontal", 1, 1},
+				{"P1", "vertical", 0, 0},
+				{"P2", "vertical", 0, 2},
+				{"P1", "vertical", 0, 1},
+			},
+			wantTurn:  "P1",
+			wantBoxes: map[[2]int]string{{0, 0}: "P1", {0, 1}: "P1"},
+			wantScore: map[string]int{"P1": 2, "P2": 0},
+			wantLines: 7,
+		},
+		{
+			name: "extra turn lets the scorer move again",
+			moves: []dotsTestMove{
+				{"P1", "horizontal", 0, 0},
+				{"P2", "horizontal", 1, 0},
+				{"P1", "vertical", 0, 0},
+				{"P2", "vertical", 0, 1},
+				{"P2", "horizontal", 3, 2},
+			},
+			wantTurn:  "P1",
+			wantBoxes: map[[2]int]string{{0, 0}: "P2"},
+			wantScore: map[string]int{"P1": 0, "P2": 1},
+			wantLines: 5,
+		},
+		{
+			name: "duplicate line is rejected",
+			moves: []dotsTestMove{
+				{"P1", "vertical", 1, 3},
+				{"P2", "vertical", 1, 3},
+			},
+			wantCode:  ErrInvalidMove,
+			wantTurn:  "P2",
+			wantScore: map[string]int{"P1": 0, "P2": 0},
+			wantLines: 1,
+		},
+		{
+			name:      "move out of turn is rejected",
+			moves:     []dotsTestMove{{"P2", "horizontal", 0, 0}},
+			wantCode:  ErrNotYourTurn,
+			wantTurn:  "P1",
+			wantScore: map[string]int{"P1": 0, "P2": 0},
+		},
+		{
+			name:      "line outside the grid is rejected",
+			moves:     []dotsTestMove{{"P1", "horizontal", 0, 3}},
+			wantCode:  ErrInvalidMove,
+			wantTurn:  "P1",
+			wantScore: map[string]int{"P1": 0, "P2": 0},
+		},
+		{
+			name:      "unknown line type is rejected",
+			moves:     []dotsTestMove{{"P1", "diagonal", 0, 0}},
+			wantCode:  ErrInvalidMove,
+			wantTurn:  "P1",
+			wantScore: map[string]int{"P1": 0, "P2": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			room := newTestRoom(t, GameTypeDots)
+			state := room.GameState.(*DotsState)
+
+			var err error
+			for i, move := range tt.moves {
+				err = room.applyMove(room.playerForRole(move.role), dotsMove(move.lineType, move.row, move.col))
+				if err != nil && i < len(tt.moves)-1 {
+					t.Fatalf("move %d: unexpected error %v", i+1, err)
+				}
+			}
+
+			if code := moveCode(t, err); code != tt.wantCode {
+				t.Errorf("last move: got code %q, want %q", code, tt.wantCode)
+			}
+			if state.CurrentTurn != tt.wantTurn {
+				t.Errorf("turn: got %s, want %s", state.CurrentTurn, tt.wantTurn)
+			}
+			if len(state.Lines) != tt.wantLines {
+				t.Errorf("lines: got %d, want %d", len(state.Lines), tt.wantLines)
+			}
+			for r := 0; r < 3; r++ {
+				for c := 0; c < 3; c++ {
+					if got, want := state.Boxes[r][c], tt.wantBoxes[[2]int{r, c}]; got != want {
+						t.Errorf("box %d,%d: got %q, want %q", r, c, got, want)
+					}
+				}
+			}
+			for role, want := range tt.wantScore {
+				if got := state.Scores[role]; got != want {
+					t.Errorf("score of %s: got %d, want %d", role, got, want)
+				}
+			}
+			if state.IsOver() {
+				t.Error("game ended early")
+			}
+		})
+	}
+}
+
+func TestDotsGameEnd(t *testing.T) {
+	room := newTestRoom(t, GameTypeDots)
+	state := room.GameState.(*DotsState)
+
+	var lines []dotsTestMove
+	for r := 0; r < 4; r++ {
+		for c := 0; c < 3; c++ {
+			lines = append(lines, dotsTestMove{lineType: "horizontal", row: r, col: c})
+		}
+	}
+	for r := 0; r < 3; r++ {
+		for c := 0; c < 4; c++ {
+			lines = append(lines, dotsTestMove{lineType: "vertical", row: r, col: c})
+		}
+	}
+
+	for i, line := range lines {
+		if state.IsOver() {
+			t.Fatalf("game ended after %d of %d lines", i, len(lines))
+		}
+		player := room.playerForRole(state.CurrentTurn)
+		if err := room.applyMove(player, dotsMove(line.lineType, line.row, line.col)); err != nil {
+			t.Fatalf("line %d: %v", i+1, err)
+		}
+	}
+
+	if !state.IsOver() {
+		t.Fatal("game still running with every line drawn")
+	}
+	if total := state.Scores["P1"] + state.Scores["P2"]; total != 9 {
+		t.Errorf("scores add up to %d, want 9", total)
+	}
+
+	want := "draw"
+	if state.Scores["P1"] > state.Scores["P2"] {
+		want = "P1"
+	} else if state.Scores["P2"] > state.Scores["P1"] {
+		want = "P2"
+	}
+
+	var ends []GameEndPayload
+	for _, msg := range sentMessages(room.playerForRole("P1").Conn) {
+		if msg.Type != "gameEnd" {
+			continue
+		}
+		var end GameEndPayload
+		if err := msg.decodePayload(&end); err != nil {
+			t.Fatal(err)
+		}
+		ends = append(ends, end)
+	}
+	if len(ends) != 1 {
+		t.Fatalf("got %d gameEnd messages, want 1", len(ends))
+	}
+	if ends[0].Winner != want {
+		t.Errorf("winner: got %s, want %s", ends[0].Winner, want)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import "fmt"
+
+// Game holds the rules and state of a single match. Each game type lives in
+// its own file and registers a constructor in init with registerGame.
+type Game interface {
+	// Roles lists the seats of the game in the order they are handed out.
+	Roles() []string
+	// MoveTypes lists the message types routed to ApplyMove.
+	MoveTypes() []string
+	// ApplyMove validates a move from player and broadcasts its outcome to
+	// the room. A rejected move leaves the game untouched and returns a
+	// *MoveError. The room lock is held by the caller.
+	ApplyMove(room *GameRoom, player *Player, msg Message) error
+	// State returns the payload of the gameState message.
+	State() interface{}
+	// IsOver reports whether the game no longer accepts moves.
+	IsOver() bool
+	// Restart resets the game for a new match in the same room.
+	Restart()
+}
+
+// MoveError explains why a move was refused.
+type MoveError struct {
+	Code   string
+	Reason string
+}
+
+func (e *MoveError) Error() string {
+	return e.Reason
+}
+
+func rejectMove(code, reason string) error {
+	return &MoveError{Code: code, Reason: reason}
+}
+
+var (
+	errMalformedMove = rejectMove(ErrInvalidMove, "Malformed move payload")
+	errNotYourTurn   = rejectMove(ErrNotYourTurn, "It is not your turn")
+)
+
+var gameRegistry = make(map[string]func() Game)
+
+func registerGame(gameType string, newGame func() Game) {
+	if _, exists := gameRegistry[gameType]; exists {
+		panic(fmt.Sprintf("game type %s registered twice", gameType))
+	}
+	gameRegistry[gameType] = newGame
+}
+
+func newGame(gameType string) (Game, bool) {
+	newGame, ok := gameRegistry[gameType]
+	if !ok {
+		return nil, false
+	}
+	return newGame(), true
+}
+
+func acceptsMove(game Game, msgType string) bool {
+	for _, t := range game.MoveTypes() {
+		if t == msgType {
+			return true
+		}
+	}
+	return false
+}
+
+// nextFreeRole returns the first seat not held by a player in the room, or ""
+// when every seat is taken.
+func (room *GameRoom) nextFreeRole() string {
+	for _, role := range room.GameState.Roles() {
+		taken := false
+		for _, player := range room.Players {
+			if player.Role == role {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			return role
+		}
+	}
+	return ""
+}
+
+func (room *GameRoom) playerForRole(role string) *Player {
+	for _, player := range room.Players {
+		if player.Role == role {
+			return player
+		}
+	}
+	return nil
+}
+
+func (room *GameRoom) usernameForRole(role string) string {
+	if player := room.playerForRole(role); player != nil {
+		return player.Username
+	}
+	return ""
+}
+
+func (room *GameRoom) sendAll(msg Message) {
+	if room.Record != nil && room.Record.capturing {
+		room.Record.captured = append(room.Record.captured, msg)
+	}
+	for client := range room.Players {
+		client.Send(msg)
+	}
+}
+
+// endGame announces the result of a game decided on the board. winner is a
+// role or "draw".
+func (room *GameRoom) endGame(winner string) {
+	room.finishGame(winner, "")
+}
+
+// finishGame announces the result of a finished game along with the reason it
+// ended when that wasn't a regular move, such as "timeout".
+func (room *GameRoom) finishGame(winner, reason string) {
+	result := GameEndPayload{Winner: winner, Reason: reason}
+	if winner != "draw" {
+		result.WinnerUsername = room.usernameForRole(winner)
+	}
+	room.sendAll(newMessage("gameEnd", result))
+	room.gameFinished(winner, reason)
+}
+
+// applyMove runs a move through the game's rules and, once accepted, hands
+// the turn clock to the next player and adds the move to the match record.
+// The caller holds room.mu.
+func (room *GameRoom) applyMove(player *Player, msg Message) error {
+	return room.captureEvent(msg.Type, player, msg.payloadJSON(), func() error {
+		if err := room.GameState.ApplyMove(room, player, msg); err != nil {
+			return err
+		}
+		room.advanceClock()
+		return nil
+	})
+}
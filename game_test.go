@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a Client with no connection behind it. Messages sent
+// to it stay queued until the test reads them with sentMessages.
+func newTestClient() *Client {
+	return &Client{send: make(chan Message, sendBufferSize), done: make(chan struct{})}
+}
+
+// sentMessages drains and returns everything queued for c.
+func sentMessages(c *Client) []Message {
+	var msgs []Message
+	for {
+		select {
+		case msg := <-c.send:
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+// newTestRoom returns a room of gameType that is not registered in rooms, with
+// a test client seated in every role.
+func newTestRoom(t testing.TB, gameType string) *GameRoom {
+	t.Helper()
+
+	game, ok := newGame(gameType)
+	if !ok {
+		t.Fatalf("unknown game type %s", gameType)
+	}
+
+	room := &GameRoom{
+		Code:      "TEST01",
+		GameType:  gameType,
+		Players:   make(map[*Client]*Player),
+		GameState: game,
+		CreatedAt: time.Now(),
+	}
+	for i, role := range game.Roles() {
+		client := newTestClient()
+		room.Players[client] = &Player{
+			Conn:      client,
+			Username:  fmt.Sprintf("player%d", i+1),
+			Role:      role,
+			Connected: true,
+		}
+		if i == 0 {
+			room.Host = client
+		}
+	}
+	return room
+}
+
+// moveCode returns the MoveError code of err, or "" when err is nil.
+func moveCode(t testing.TB, err error) string {
+	t.Helper()
+
+	if err == nil {
+		return ""
+	}
+	moveErr, ok := err.(*MoveError)
+	if !ok {
+		t.Fatalf("error %v is a %T, not a *MoveError", err, err)
+	}
+	return moveErr.Code
+}
@@ -2,4 +2,4 @@ module minigames-server
 
 go 1.21.0
 
-require github.com/gorilla/websocket v1.5.3 // indirect
+require github.com/gorilla/websocket v1.5.3
@@ -0,0 +1,114 @@
+package main
+
+import "math/rand"
+
+type GuessNumberState struct {
+	TargetNumber int
+	Guesses      map[string][]int
+	MaxGuesses   int
+	GameActive   bool
+	Winner       string
+}
+
+type NumberGuessResultPayload struct {
+	Player     string `json:"player"`
+	Username   string `json:"username"`
+	Guess      int    `json:"guess"`
+	Result     string `json:"result"`
+	Target     int    `json:"target"`
+	GameActive bool   `json:"gameActive"`
+	Winner     string `json:"winner"`
+}
+
+func init() {
+	registerGame(GameTypeGuessNumber, newGuessNumberState)
+}
+
+func newGuessNumberState() Game {
+	return &GuessNumberState{
+		TargetNumber: rand.Intn(100) + 1,
+		Guesses:      make(map[string][]int),
+		MaxGuesses:   10,
+		GameActive:   true,
+	}
+}
+
+func (state *GuessNumberState) Roles() []string {
+	return []string{"P1", "P2"}
+}
+
+func (state *GuessNumberState) MoveTypes() []string {
+	return []string{"numberGuess"}
+}
+
+func (state *GuessNumberState) State() interface{} {
+	return struct {
+		Guesses    map[string][]int `json:"guesses"`
+		MaxGuesses int              `json:"maxGuesses"`
+		GameActive bool             `json:"gameActive"`
+		Winner     string           `json:"winner"`
+	}{state.Guesses, state.MaxGuesses, state.GameActive, state.Winner}
+}
+
+func (state *GuessNumberState) IsOver() bool {
+	return !state.GameActive
+}
+
+func (state *GuessNumberState) Restart() {
+	*state = *newGuessNumberState().(*GuessNumberState)
+}
+
+func (state *GuessNumberState) ApplyMove(room *GameRoom, player *Player, msg Message) error {
+	var guess struct {
+		Number int `json:"number"`
+	}
+	if err := msg.decodePayload(&guess); err != nil {
+		return errMalformedMove
+	}
+
+	if guess.Number < 1 || guess.Number > 100 {
+		return rejectMove(ErrInvalidMove, "Guess must be between 1 and 100")
+	}
+
+	if len(state.Guesses[player.Role]) >= state.MaxGuesses {
+		return rejectMove(ErrInvalidMove, "You have no guesses left")
+	}
+
+	state.Guesses[player.Role] = append(state.Guesses[player.Role], guess.Number)
+
+	var result string
+	if guess.Number == state.TargetNumber {
+		result = "correct"
+		state.Winner = player.Role
+		state.GameActive = false
+	} else if guess.Number < state.TargetNumber {
+		result = "higher"
+	} else {
+		result = "lower"
+	}
+
+	if len(state.Guesses[player.Role]) >= state.MaxGuesses && state.GameActive {
+		state.GameActive = false
+		otherRole := "P1"
+		if player.Role == "P1" {
+			otherRole = "P2"
+		}
+		if state.Winner == "" {
+			state.Winner = otherRole
+		}
+	}
+
+	room.sendAll(newMessage("numberGuessResult", NumberGuessResultPayload{
+		Player:     player.Role,
+		Username:   player.Username,
+		Guess:      guess.Number,
+		Result:     result,
+		Target:     state.TargetNumber,
+		GameActive: state.GameActive,
+		Winner:     state.Winner,
+	}))
+	if !state.GameActive {
+		room.gameFinished(state.Winner, "")
+	}
+	return nil
+}
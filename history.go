@@ -0,0 +1,428 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MatchRecord is the full event log of one game, from the first move to the
+// result. Records are written to disk once the game is decided or abandoned.
+type MatchRecord struct {
+	ID           string          `json:"id"`
+	RoomCode     string          `json:"roomCode"`
+	GameType     string          `json:"gameType"`
+	Players      []MatchPlayer   `json:"players"`
+	InitialState json.RawMessage `json:"initialState"`
+	Events       []MatchEvent    `json:"events"`
+	Result       *MatchResult    `json:"result"`
+	StartedAt    time.Time       `json:"startedAt"`
+	EndedAt      time.Time       `json:"endedAt"`
+
+	capturing bool
+	captured  []Message
+}
+
+type MatchPlayer struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Bot      bool   `json:"bot,omitempty"`
+}
+
+// MatchEvent is one accepted move, or a turn lost to the clock, together with
+// every message the room was sent in response and the game state after it.
+type MatchEvent struct {
+	Seq      int             `json:"seq"`
+	Time     time.Time       `json:"time"`
+	Type     string          `json:"type"`
+	Role     string          `json:"role"`
+	Username string          `json:"username"`
+	Move     json.RawMessage `json:"move,omitempty"`
+	Messages []Message       `json:"messages"`
+	State    json.RawMessage `json:"state"`
+}
+
+type MatchResult struct {
+	Winner         string `json:"winner"`
+	WinnerUsername string `json:"winnerUsername,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+// MatchSummary is the listing entry for a stored match.
+type MatchSummary struct {
+	ID        string        `json:"id"`
+	RoomCode  string        `json:"roomCode"`
+	GameType  string        `json:"gameType"`
+	Players   []MatchPlayer `json:"players"`
+	Result    *MatchResult  `json:"result"`
+	Moves     int           `json:"moves"`
+	StartedAt time.Time     `json:"startedAt"`
+	EndedAt   time.Time     `json:"endedAt"`
+}
+
+func (record *MatchRecord) summary() MatchSummary {
+	return MatchSummary{
+		ID:        record.ID,
+		RoomCode:  record.RoomCode,
+		GameType:  record.GameType,
+		Players:   record.Players,
+		Result:    record.Result,
+		Moves:     len(record.Events),
+		StartedAt: record.StartedAt,
+		EndedAt:   record.EndedAt,
+	}
+}
+
+var matchIDPattern = regexp.MustCompile(`^[0-9]+-[A-Z0-9]+$`)
+
+// MatchStore keeps one JSON file per match in a directory and an in-memory
+// index of their summaries, newest last, along with the player statistics
+// drawn from them.
+type MatchStore struct {
+	dir   string
+	mu    sync.RWMutex
+	index []MatchSummary
+	stats map[string]map[string]*GameStats // by game type, then username
+
+	// Finished games are queued and written one at a time, in the order
+	// they ended, so the index and the streaks in stats stay in order.
+	queueMu sync.Mutex
+	queue   []*MatchRecord
+	unsaved int // queued or being written
+	saved   *sync.Cond
+	wake    chan struct{}
+}
+
+var matchStore *MatchStore
+
+func openMatchStore(dir string) (*MatchStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	store := &MatchStore{
+		dir:   dir,
+		stats: make(map[string]map[string]*GameStats),
+		wake:  make(chan struct{}, 1),
+	}
+	store.saved = sync.NewCond(&store.queueMu)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !matchIDPattern.MatchString(id) {
+			continue
+		}
+		record, err := store.Get(id)
+		if err != nil {
+			slog.Warn("Skipping unreadable match record", "file", entry.Name(), "err", err)
+			continue
+		}
+		store.index = append(store.index, record.summary())
+	}
+	sort.Slice(store.index, func(i, j int) bool {
+		return store.index[i].EndedAt.Before(store.index[j].EndedAt)
+	})
+	for _, summary := range store.index {
+		store.addStats(summary)
+	}
+
+	go store.writeQueue()
+	return store, nil
+}
+
+func (store *MatchStore) path(id string) string {
+	return filepath.Join(store.dir, id+".json")
+}
+
+// Save writes record to disk. The record must not be modified afterwards.
+func (store *MatchStore) Save(record *MatchRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := store.path(record.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, store.path(record.ID)); err != nil {
+		return err
+	}
+
+	summary := record.summary()
+	store.mu.Lock()
+	store.index = append(store.index, summary)
+	store.addStats(summary)
+	store.mu.Unlock()
+	return nil
+}
+
+// enqueue stamps record as ended and queues it to be saved after every record
+// queued before it. It never blocks on the disk.
+func (store *MatchStore) enqueue(record *MatchRecord) {
+	store.queueMu.Lock()
+	record.EndedAt = time.Now()
+	store.queue = append(store.queue, record)
+	store.unsaved++
+	store.queueMu.Unlock()
+
+	select {
+	case store.wake <- struct{}{}:
+	default:
+	}
+}
+
+// writeQueue saves queued records one at a time for as long as the store is
+// open.
+func (store *MatchStore) writeQueue() {
+	for range store.wake {
+		for {
+			store.queueMu.Lock()
+			if len(store.queue) == 0 {
+				store.queueMu.Unlock()
+				break
+			}
+			record := store.queue[0]
+			store.queue[0] = nil
+			store.queue = store.queue[1:]
+			store.queueMu.Unlock()
+
+			if err := store.Save(record); err != nil {
+				slog.Error("Error saving match", "match", record.ID, "err", err)
+			}
+
+			store.queueMu.Lock()
+			store.unsaved--
+			store.saved.Broadcast()
+			store.queueMu.Unlock()
+		}
+	}
+}
+
+// Flush waits until every queued record has been written.
+func (store *MatchStore) Flush() {
+	store.queueMu.Lock()
+	defer store.queueMu.Unlock()
+	for store.unsaved > 0 {
+		store.saved.Wait()
+	}
+}
+
+func (store *MatchStore) Get(id string) (*MatchRecord, error) {
+	if !matchIDPattern.MatchString(id) {
+		return nil, os.ErrNotExist
+	}
+
+	data, err := os.ReadFile(store.path(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var record MatchRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// List returns up to limit summaries, newest first, optionally narrowed to a
+// game type and to matches a username played in.
+func (store *MatchStore) List(gameType, username string, limit int) []MatchSummary {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	matches := make([]MatchSummary, 0)
+	for i := len(store.index) - 1; i >= 0 && len(matches) < limit; i-- {
+		summary := store.index[i]
+		if gameType != "" && summary.GameType != gameType {
+			continue
+		}
+		if username != "" && !summary.hasPlayer(username) {
+			continue
+		}
+		matches = append(matches, summary)
+	}
+	return matches
+}
+
+func (summary MatchSummary) hasPlayer(username string) bool {
+	for _, player := range summary.Players {
+		if player.Username == username {
+			return true
+		}
+	}
+	return false
+}
+
+// startRecord opens a new match record for the game about to be played,
+// saving whatever was left of the previous one. The caller holds room.mu.
+func (room *GameRoom) startRecord() {
+	room.closeRecord("abandoned")
+
+	record := &MatchRecord{
+		ID:        fmt.Sprintf("%d-%s", time.Now().UnixNano(), room.Code),
+		RoomCode:  room.Code,
+		GameType:  room.GameType,
+		Events:    []MatchEvent{},
+		StartedAt: time.Now(),
+	}
+	for _, role := range room.GameState.Roles() {
+		for _, player := range room.Players {
+			if player.Role == role {
+				record.Players = append(record.Players, MatchPlayer{
+					Username: player.Username,
+					Role:     player.Role,
+					Bot:      player.BotLevel != "",
+				})
+			}
+		}
+	}
+	record.InitialState, _ = json.Marshal(room.GameState.State())
+
+	room.Record = record
+}
+
+// captureEvent runs fn and stores everything it broadcast to the room as one
+// event of the current record.
+func (room *GameRoom) captureEvent(eventType string, player *Player, move json.RawMessage, fn func() error) error {
+	record := room.Record
+	if record == nil {
+		return fn()
+	}
+
+	record.capturing = true
+	record.captured = nil
+	err := fn()
+	record.capturing = false
+
+	if err == nil {
+		event := MatchEvent{
+			Seq:      len(record.Events) + 1,
+			Time:     time.Now(),
+			Type:     eventType,
+			Move:     move,
+			Messages: record.captured,
+		}
+		event.State, _ = json.Marshal(room.GameState.State())
+		if player != nil {
+			event.Role = player.Role
+			event.Username = player.Username
+		}
+		record.Events = append(record.Events, event)
+	}
+	record.captured = nil
+
+	if record.Result != nil {
+		room.closeRecord("")
+		// Games such as rock paper scissors go straight into the next round.
+		if !room.GameState.IsOver() {
+			room.startRecord()
+		}
+	}
+	return err
+}
+
+// gameFinished stores the result of the game being recorded and updates the
+// players' ratings. Every way a game can end goes through here.
+func (room *GameRoom) gameFinished(winner, reason string) {
+	room.updateRatings(winner)
+	gamesFinished.inc(room.GameType, gameOutcome(winner, reason))
+
+	record := room.Record
+	if record == nil {
+		return
+	}
+
+	record.Result = &MatchResult{Winner: winner, Reason: reason}
+	if winner != "draw" {
+		record.Result.WinnerUsername = room.usernameForRole(winner)
+	}
+}
+
+// closeRecord saves the current record, if any moves were made, and detaches
+// it from the room. An unfinished game is stored with the given reason.
+func (room *GameRoom) closeRecord(reason string) {
+	record := room.Record
+	if record == nil {
+		return
+	}
+	room.Record = nil
+
+	if len(record.Events) == 0 {
+		return
+	}
+	if record.Result == nil {
+		record.Result = &MatchResult{Reason: reason}
+		gamesFinished.inc(room.GameType, reason)
+	}
+	if matchStore == nil {
+		return
+	}
+	matchStore.enqueue(record)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, ErrorPayload{Code: code, Message: message})
+}
+
+// handleListMatches serves GET /api/matches?game=&player=&limit=.
+func handleListMatches(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Use GET")
+		return
+	}
+
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 500 {
+			writeJSONError(w, http.StatusBadRequest, "BAD_REQUEST", "limit must be between 1 and 500")
+			return
+		}
+		limit = n
+	}
+
+	query := r.URL.Query()
+	writeJSON(w, http.StatusOK, matchStore.List(query.Get("game"), query.Get("player"), limit))
+}
+
+// handleGetMatch serves GET /api/matches/{id}.
+func handleGetMatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Use GET")
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/matches/")
+	record, err := matchStore.Get(id)
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeJSONError(w, http.StatusNotFound, "MATCH_NOT_FOUND", fmt.Sprintf("Match %s not found", id))
+		} else {
+			slog.Error("Error reading match", "match", id, "err", err)
+			writeJSONError(w, http.StatusInternalServerError, "INTERNAL", "Could not read match")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, record)
+}
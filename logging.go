@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are never written to the logs, whether they turn up as a log
+// attribute or as a field of a logged message payload.
+var sensitiveKeys = map[string]bool{
+	"token":    true,
+	"password": true,
+}
+
+func parseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return level, fmt.Errorf("log-level must be debug, info, warn or error")
+	}
+	return level, nil
+}
+
+func newLogHandler(w io.Writer, level slog.Level, format string) slog.Handler {
+	options := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if sensitiveKeys[strings.ToLower(a.Key)] {
+				a.Value = slog.StringValue(redacted)
+			}
+			return a
+		},
+	}
+	if format == "json" {
+		return slog.NewJSONHandler(w, options)
+	}
+	return slog.NewTextHandler(w, options)
+}
+
+// setupLogging sends all logging, including the standard library's log
+// package, through a slog handler configured by cfg.
+func setupLogging(cfg Config) {
+	level, _ := parseLogLevel(cfg.LogLevel)
+	slog.SetDefault(slog.New(newLogHandler(os.Stderr, level, cfg.LogFormat)))
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
+
+// redactPayload returns a message payload fit for the logs, with the values
+// of sensitive fields replaced at any depth.
+func redactPayload(payload json.RawMessage) string {
+	var v interface{}
+	if err := json.Unmarshal(payload, &v); err != nil {
+		return string(payload)
+	}
+	data, _ := json.Marshal(redactValue(v))
+	return string(data)
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if sensitiveKeys[strings.ToLower(key)] {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+	}
+	return v
+}
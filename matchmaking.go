@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	matchmakingTick = 2 * time.Second
+
+	// A queued player starts out only matched against ratings within
+	// ratingBandStart of their own. The band widens by ratingBandStep every
+	// ratingBandEvery they wait.
+	ratingBandStart = 100
+	ratingBandStep  = 50
+	ratingBandEvery = 10 * time.Second
+)
+
+type queueEntry struct {
+	client   *Client
+	username string
+	gameType string
+	rating   float64
+	joinedAt time.Time
+}
+
+type QueueStatusPayload struct {
+	GameType    string `json:"gameType"`
+	Position    int    `json:"position"`
+	Waiting     int    `json:"waiting"`
+	WaitSeconds int    `json:"waitSeconds"`
+	RatingBand  int    `json:"ratingBand,omitempty"`
+}
+
+type QueueCancelledPayload struct {
+	GameType string `json:"gameType"`
+}
+
+var (
+	// matchQueues holds the players waiting for each game type, longest
+	// waiting first. queuedClients indexes the same entries by client.
+	matchQueues   = make(map[string][]*queueEntry)
+	queuedClients = make(map[*Client]*queueEntry)
+	matchQueuesMu sync.Mutex
+)
+
+// ratingBand is how far apart two ratings may be for entry to be matched.
+func (entry *queueEntry) ratingBand(now time.Time) float64 {
+	steps := math.Floor(float64(now.Sub(entry.joinedAt)) / float64(ratingBandEvery))
+	return ratingBandStart + ratingBandStep*steps
+}
+
+func compatible(a, b *queueEntry, now time.Time) bool {
+	if a.username == b.username {
+		return false
+	}
+	if !ratedGames[a.gameType] {
+		return true
+	}
+	band := math.Max(a.ratingBand(now), b.ratingBand(now))
+	return math.Abs(a.rating-b.rating) <= band
+}
+
+func handleQueue(ws *Client, msg Message) {
+	var payload struct {
+		GameType string `json:"gameType"`
+		Username string `json:"username"`
+	}
+	if err := msg.decodePayload(&payload); err != nil {
+		sendError(ws, ErrBadMessage, "Invalid queue payload")
+		return
+	}
+	if payload.GameType == "" {
+		payload.GameType = msg.GameType
+	}
+	if payload.Username == "" {
+		payload.Username = msg.Username
+	}
+
+	if _, ok := gameRegistry[payload.GameType]; !ok {
+		sendError(ws, ErrUnknownGameType, fmt.Sprintf("Unknown game type %s", payload.GameType))
+		return
+	}
+	if payload.Username == "" {
+		sendError(ws, ErrBadMessage, "A username is required to queue")
+		return
+	}
+	if findPlayerRoom(ws) != nil {
+		sendError(ws, ErrAlreadyInRoom, "Leave your current room before queueing")
+		return
+	}
+
+	entry := &queueEntry{
+		client:   ws,
+		username: payload.Username,
+		gameType: payload.GameType,
+		rating:   initialRating,
+		joinedAt: time.Now(),
+	}
+	if ratingStore != nil {
+		entry.rating = ratingStore.Get(entry.gameType, entry.username).Rating
+	}
+
+	matchQueuesMu.Lock()
+	if queued := queuedClients[ws]; queued != nil {
+		matchQueuesMu.Unlock()
+		sendError(ws, ErrAlreadyQueued, fmt.Sprintf("Already queued for %s", queued.gameType))
+		return
+	}
+	for _, other := range matchQueues[entry.gameType] {
+		if other.username == entry.username {
+			matchQueuesMu.Unlock()
+			sendError(ws, ErrUsernameTaken, fmt.Sprintf("%s is already queued", entry.username))
+			return
+		}
+	}
+	matchQueues[entry.gameType] = append(matchQueues[entry.gameType], entry)
+	queuedClients[ws] = entry
+	matchQueuesMu.Unlock()
+
+	ws.logger().Info("Queued for a match", "username", entry.username, "game", entry.gameType)
+
+	matchQueue(entry.gameType)
+	sendQueueStatus(entry.gameType)
+}
+
+func handleCancelQueue(ws *Client) {
+	entry := leaveQueue(ws)
+	if entry == nil {
+		sendError(ws, ErrNotQueued, "You are not in a matchmaking queue")
+		return
+	}
+	ws.Send(newMessage("queueCancelled", QueueCancelledPayload{GameType: entry.gameType}))
+}
+
+// leaveQueue takes ws out of whichever queue it is in and returns its entry,
+// or nil if it was not queued.
+func leaveQueue(ws *Client) *queueEntry {
+	matchQueuesMu.Lock()
+	entry := queuedClients[ws]
+	if entry != nil {
+		removeQueueEntry(entry)
+	}
+	matchQueuesMu.Unlock()
+
+	if entry != nil {
+		sendQueueStatus(entry.gameType)
+	}
+	return entry
+}
+
+// leaveQueueForRoom takes ws out of the matchmaking queue, if it was waiting,
+// because it has taken a seat in a room of its own choosing.
+func leaveQueueForRoom(ws *Client) {
+	if entry := leaveQueue(ws); entry != nil {
+		ws.Send(newMessage("queueCancelled", QueueCancelledPayload{GameType: entry.gameType}))
+	}
+}
+
+// requeue puts entry back in its place in the queue after its match fell
+// through, unless its player has disconnected since. Checking under
+// matchQueuesMu means a disconnect either comes after and leaveQueue finds the
+// entry, or came before and the entry is dropped here.
+func requeue(entry *queueEntry) {
+	matchQueuesMu.Lock()
+	defer matchQueuesMu.Unlock()
+
+	if queuedClients[entry.client] != nil || entry.client.closed() {
+		return
+	}
+	queue := matchQueues[entry.gameType]
+	i := sort.Search(len(queue), func(i int) bool {
+		return queue[i].joinedAt.After(entry.joinedAt)
+	})
+	matchQueues[entry.gameType] = append(queue[:i:i], append([]*queueEntry{entry}, queue[i:]...)...)
+	queuedClients[entry.client] = entry
+}
+
+// removeQueueEntry drops entry from the queue. The caller holds matchQueuesMu.
+func removeQueueEntry(entry *queueEntry) {
+	delete(queuedClients, entry.client)
+	queue := matchQueues[entry.gameType]
+	for i, other := range queue {
+		if other == entry {
+			matchQueues[entry.gameType] = append(queue[:i:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(matchQueues[entry.gameType]) == 0 {
+		delete(matchQueues, entry.gameType)
+	}
+}
+
+// matchQueue pairs off every compatible couple in gameType's queue, longest
+// waiting first, and starts a game for each pair.
+func matchQueue(gameType string) {
+	now := time.Now()
+	var pairs [][2]*queueEntry
+
+	matchQueuesMu.Lock()
+	for i := 0; i < len(matchQueues[gameType]); i++ {
+		queue := matchQueues[gameType]
+		for j := i + 1; j < len(queue); j++ {
+			if compatible(queue[i], queue[j], now) {
+				a, b := queue[i], queue[j]
+				pairs = append(pairs, [2]*queueEntry{a, b})
+				removeQueueEntry(b)
+				removeQueueEntry(a)
+				i--
+				break
+			}
+		}
+	}
+	matchQueuesMu.Unlock()
+
+	for _, pair := range pairs {
+		startMatch(pair[0], pair[1])
+	}
+}
+
+// startMatch creates a room for two matched players, the longer waiting one
+// hosting, and starts the game straight away. A player who took a seat
+// elsewhere or disconnected since being matched calls the match off, and the
+// other goes back to the queue.
+//
+// Both checks and the seating happen under roomsMu, which handleJoinRoom and
+// handleDisconnect also hold when they look a client's room up.
+func startMatch(a, b *queueEntry) {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+
+	aFree := findPlayerRoom(a.client) == nil && !a.client.closed()
+	bFree := findPlayerRoom(b.client) == nil && !b.client.closed()
+	if !aFree || !bFree {
+		if aFree {
+			requeue(a)
+		}
+		if bFree {
+			requeue(b)
+		}
+		return
+	}
+
+	room, _ := newRoom(a.gameType, a.client)
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	roles := room.GameState.Roles()
+	for i, entry := range []*queueEntry{a, b} {
+		room.Players[entry.client] = &Player{
+			Conn:      entry.client,
+			Username:  entry.username,
+			Role:      roles[i],
+			Token:     generateToken(),
+			Connected: true,
+		}
+	}
+
+	rooms[room.Code] = room
+	for client, player := range room.Players {
+		setPlayerRoom(client, room)
+		client.Send(newMessage("roomJoined", RoomJoinedPayload{
+			Code:     room.Code,
+			Role:     player.Role,
+			GameType: room.GameType,
+			IsHost:   client == room.Host,
+			Username: player.Username,
+			Token:    player.Token,
+		}))
+	}
+
+	slog.Info("Matched players", "room", room.Code, "game", room.GameType, "players", []string{a.username, b.username})
+
+	updateLobby(room)
+	startGame(room)
+}
+
+// sendQueueStatus tells everyone waiting for gameType where they stand.
+func sendQueueStatus(gameType string) {
+	matchQueuesMu.Lock()
+	defer matchQueuesMu.Unlock()
+
+	now := time.Now()
+	queue := matchQueues[gameType]
+	for i, entry := range queue {
+		status := QueueStatusPayload{
+			GameType:    gameType,
+			Position:    i + 1,
+			Waiting:     len(queue),
+			WaitSeconds: int(now.Sub(entry.joinedAt).Seconds()),
+		}
+		if ratedGames[gameType] {
+			status.RatingBand = int(entry.ratingBand(now))
+		}
+		entry.client.Send(newMessage("queueStatus", status))
+	}
+}
+
+// matchmakingRoutine retries every queue as rating bands widen and keeps
+// waiting players informed.
+func matchmakingRoutine() {
+	ticker := time.NewTicker(matchmakingTick)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		matchQueuesMu.Lock()
+		gameTypes := make([]string, 0, len(matchQueues))
+		for gameType := range matchQueues {
+			gameTypes = append(gameTypes, gameType)
+		}
+		matchQueuesMu.Unlock()
+
+		for _, gameType := range gameTypes {
+			matchQueue(gameType)
+			sendQueueStatus(gameType)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStartMatchSkipsSeatedPlayer(t *testing.T) {
+	room := newTestRoom(t, GameTypeTicTacToe)
+	registerTestRoom(t, room)
+
+	var seated *Client
+	for client := range room.Players {
+		seated = client
+		break
+	}
+	free := newTestClient()
+
+	now := time.Now()
+	a := &queueEntry{client: seated, username: "seated", gameType: GameTypeTicTacToe, joinedAt: now.Add(-time.Minute)}
+	b := &queueEntry{client: free, username: "free", gameType: GameTypeTicTacToe, joinedAt: now}
+	t.Cleanup(func() {
+		leaveQueue(a.client)
+		leaveQueue(b.client)
+	})
+
+	roomsMu.Lock()
+	before := len(rooms)
+	roomsMu.Unlock()
+
+	startMatch(a, b)
+
+	roomsMu.Lock()
+	after := len(rooms)
+	roomsMu.Unlock()
+
+	if after != before {
+		t.Errorf("a room was created for a player already seated elsewhere")
+	}
+	if findPlayerRoom(seated) != room {
+		t.Error("the seated player was moved out of their room")
+	}
+	if findPlayerRoom(free) != nil {
+		t.Error("the free player was seated")
+	}
+
+	matchQueuesMu.Lock()
+	defer matchQueuesMu.Unlock()
+	if queuedClients[free] != b {
+		t.Error("the free player was not put back in the queue")
+	}
+	if queuedClients[seated] != nil {
+		t.Error("the seated player was put back in the queue")
+	}
+}
+
+func TestStartMatchSkipsDisconnectedPlayer(t *testing.T) {
+	gone, waiting := newTestClient(), newTestClient()
+
+	now := time.Now()
+	a := &queueEntry{client: gone, username: "gone", gameType: GameTypeTicTacToe, joinedAt: now.Add(-time.Minute)}
+	b := &queueEntry{client: waiting, username: "waiting", gameType: GameTypeTicTacToe, joinedAt: now}
+	t.Cleanup(func() {
+		leaveQueue(a.client)
+		leaveQueue(b.client)
+	})
+
+	// matchQueue has taken both off the queue, so the disconnect finds
+	// nothing to clean up before startMatch runs.
+	gone.Close()
+	leaveQueue(gone)
+	handleDisconnect(gone)
+
+	roomsMu.Lock()
+	before := len(rooms)
+	roomsMu.Unlock()
+
+	startMatch(a, b)
+
+	roomsMu.Lock()
+	after := len(rooms)
+	roomsMu.Unlock()
+
+	if after != before {
+		t.Errorf("a room was created for a player who had disconnected")
+	}
+	if findPlayerRoom(gone) != nil || findPlayerRoom(waiting) != nil {
+		t.Error("a player was seated")
+	}
+
+	matchQueuesMu.Lock()
+	defer matchQueuesMu.Unlock()
+	if queuedClients[waiting] != b {
+		t.Error("the waiting player was not put back in the queue")
+	}
+	if queuedClients[gone] != nil {
+		t.Error("the disconnected player was put back in the queue")
+	}
+}
+
+func TestRequeueSkipsDisconnectedPlayer(t *testing.T) {
+	client := newTestClient()
+	entry := &queueEntry{client: client, username: "gone", gameType: GameTypeConnect4, joinedAt: time.Now()}
+	client.Close()
+
+	requeue(entry)
+
+	matchQueuesMu.Lock()
+	defer matchQueuesMu.Unlock()
+	if queuedClients[client] != nil || len(matchQueues[GameTypeConnect4]) != 0 {
+		removeQueueEntry(entry)
+		t.Error("a closed client was put back in the queue")
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+)
+
+// protocolVersion is stamped on every outgoing message. Version 1 clients
+// sent and received payloads as JSON encoded inside a string; version 2
+// payloads are plain JSON objects.
+const protocolVersion = 2
+
+// Error codes carried by "error" messages so clients can react without
+// parsing the human readable text.
+const (
+	ErrRoomNotFound       = "ROOM_NOT_FOUND"
+	ErrNotYourTurn        = "NOT_YOUR_TURN"
+	ErrInvalidMove        = "INVALID_MOVE"
+	ErrNotHost            = "NOT_HOST"
+	ErrNotInRoom          = "NOT_IN_ROOM"
+	ErrUnknownGameType    = "UNKNOWN_GAME_TYPE"
+	ErrUsernameTaken      = "USERNAME_TAKEN"
+	ErrSpectator          = "SPECTATOR"
+	ErrGameOver           = "GAME_OVER"
+	ErrBadMessage         = "BAD_MESSAGE"
+	ErrBotUnavailable     = "BOT_UNAVAILABLE"
+	ErrInvalidTimeControl = "INVALID_TIME_CONTROL"
+	ErrReplayNotFound     = "REPLAY_NOT_FOUND"
+	ErrAlreadyInRoom      = "ALREADY_IN_ROOM"
+	ErrAlreadyQueued      = "ALREADY_QUEUED"
+	ErrNotQueued          = "NOT_QUEUED"
+	ErrPasswordRequired   = "PASSWORD_REQUIRED"
+	ErrWrongPassword      = "WRONG_PASSWORD"
+	ErrTooManyAttempts    = "TOO_MANY_ATTEMPTS"
+	ErrInvalidPassword    = "INVALID_PASSWORD"
+	ErrPlayerNotFound     = "PLAYER_NOT_FOUND"
+	ErrBanned             = "BANNED"
+	ErrChatTooLong        = "CHAT_TOO_LONG"
+	ErrTooManyRooms       = "TOO_MANY_ROOMS"
+	ErrGameNotStarted     = "GAME_NOT_STARTED"
+)
+
+type Message struct {
+	Version  int             `json:"v,omitempty"`
+	Type     string          `json:"type"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	GameType string          `json:"gameType,omitempty"`
+	Code     string          `json:"code,omitempty"`
+	Username string          `json:"username,omitempty"`
+}
+
+// newMessage builds an outgoing message with payload encoded as a JSON object.
+func newMessage(msgType string, payload interface{}) Message {
+	msg := Message{Version: protocolVersion, Type: msgType}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			slog.Error("Error encoding payload", "type", msgType, "err", err)
+		}
+		msg.Payload = data
+	}
+	return msg
+}
+
+// decodePayload unmarshals the payload into v. Both the current object form
+// and the legacy string-wrapped form are accepted.
+func (msg Message) decodePayload(v interface{}) error {
+	data := msg.Payload
+	if len(data) > 0 && data[0] == '"' {
+		var inner string
+		if err := json.Unmarshal(data, &inner); err != nil {
+			return err
+		}
+		data = json.RawMessage(inner)
+	}
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// payloadJSON returns the payload as a JSON object, unwrapping the legacy
+// string form.
+func (msg Message) payloadJSON() json.RawMessage {
+	data := msg.Payload
+	if len(data) > 0 && data[0] == '"' {
+		var inner string
+		if err := json.Unmarshal(data, &inner); err != nil || !json.Valid([]byte(inner)) {
+			return nil
+		}
+		return json.RawMessage(inner)
+	}
+	return data
+}
+
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func sendError(ws *Client, code, message string) {
+	ws.Send(newMessage("error", ErrorPayload{Code: code, Message: message}))
+}
+
+type MoveRejectedPayload struct {
+	Type   string `json:"type"`
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// sendMoveRejected tells a player why the move carried by a msgType message
+// was not applied.
+func sendMoveRejected(ws *Client, msgType string, err error) {
+	payload := MoveRejectedPayload{Type: msgType, Code: ErrInvalidMove, Reason: err.Error()}
+	if moveErr, ok := err.(*MoveError); ok {
+		payload.Code = moveErr.Code
+	}
+	movesRejected.inc(payload.Code)
+	ws.Send(newMessage("moveRejected", payload))
+}
+
+type RoomJoinedPayload struct {
+	Code     string `json:"code"`
+	Role     string `json:"role"`
+	GameType string `json:"gameType"`
+	IsHost   bool   `json:"isHost"`
+	Username string `json:"username"`
+	Token    string `json:"token"`
+}
+
+type PlayerInfo struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	IsHost   bool   `json:"isHost"`
+	Rating   int    `json:"rating,omitempty"`
+}
+
+type LobbyUpdatePayload struct {
+	Code       string       `json:"code"`
+	Players    []PlayerInfo `json:"players"`
+	Spectators []PlayerInfo `json:"spectators"`
+	GameType   string       `json:"gameType"`
+	IsHost     bool         `json:"isHost"`
+	Username   string       `json:"username"`
+}
+
+type StartGamePayload struct {
+	Code     string `json:"code"`
+	GameType string `json:"gameType"`
+	IsHost   bool   `json:"isHost"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type GameEndPayload struct {
+	Winner         string `json:"winner"`
+	WinnerUsername string `json:"winnerUsername,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+type PlayerLeftPayload struct {
+	Player   string `json:"player"`
+	Username string `json:"username"`
+	IsHost   bool   `json:"isHost"`
+}
+
+type HostLeftPayload struct {
+	Username string `json:"username"`
+	Message  string `json:"message"`
+}
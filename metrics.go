@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Counters and histograms served on /metrics in the Prometheus text format.
+// Gauges are computed from the live server state on every scrape instead.
+var (
+	messagesReceived = newCounterVec("minigames_messages_received_total",
+		"Websocket messages received, by message type.", "type")
+	movesRejected = newCounterVec("minigames_moves_rejected_total",
+		"Moves refused with a moveRejected message, by error code.", "code")
+	gamesFinished = newCounterVec("minigames_games_finished_total",
+		"Games that ended, by game type and outcome.", "game_type", "outcome")
+	reconnects = newCounterVec("minigames_reconnects_total",
+		"Players who reclaimed their seat with a session token.")
+	rateLimited = newCounterVec("minigames_rate_limited_total",
+		"Messages refused for exceeding a rate limit, by message type.", "type")
+	roomCleanups = newCounterVec("minigames_room_cleanups_total",
+		"Empty rooms removed by the cleanup routine.")
+
+	messageDuration = newHistogramVec("minigames_message_handler_duration_seconds",
+		"Time spent handling a websocket message, by message type.", "type")
+	httpDuration = newHistogramVec("minigames_http_request_duration_seconds",
+		"Time spent serving an HTTP API request, by route.", "path")
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the handler latency
+// histograms.
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// controlMessageTypes are the message types handled outside of a game. Any
+// type that is neither one of these nor a game's move is counted as "other"
+// so that clients cannot create unbounded label values.
+var controlMessageTypes = []string{
+	"create", "join", "restart", "getGameState", "replay", "replayControl",
+	"listRooms", "unlistRooms", "queue", "cancelQueue", "kick", "ban",
+	"transferHost", "chat",
+}
+
+var (
+	knownMessageTypes     map[string]bool
+	knownMessageTypesOnce sync.Once
+)
+
+func messageTypeLabel(msgType string) string {
+	knownMessageTypesOnce.Do(func() {
+		knownMessageTypes = make(map[string]bool)
+		for _, t := range controlMessageTypes {
+			knownMessageTypes[t] = true
+		}
+		for _, newGame := range gameRegistry {
+			for _, t := range newGame().MoveTypes() {
+				knownMessageTypes[t] = true
+			}
+		}
+	})
+
+	if knownMessageTypes[msgType] {
+		return msgType
+	}
+	return "other"
+}
+
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64 // keyed by labelKey
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+// inc adds one to the counter with the given label values, which follow the
+// order of the labels the counter was created with.
+func (c *counterVec) inc(values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[labelKey(values)]++
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	if len(c.labels) == 0 {
+		fmt.Fprintf(w, "%s %g\n", c.name, c.values[""])
+		return
+	}
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %g\n", c.name, formatLabels(c.labels, splitLabelKey(key)), c.values[key])
+	}
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+type histogramVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*histogram
+}
+
+func newHistogramVec(name, help string, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, values: make(map[string]*histogram)}
+}
+
+func (h *histogramVec) observe(d time.Duration, values ...string) {
+	seconds := d.Seconds()
+	key := labelKey(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hist := h.values[key]
+	if hist == nil {
+		hist = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		h.values[key] = hist
+	}
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			hist.counts[i]++
+			break
+		}
+	}
+	hist.sum += seconds
+	hist.count++
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		hist := h.values[key]
+		values := splitLabelKey(key)
+		labels := append(append([]string{}, h.labels...), "le")
+
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(labels, append(values, fmt.Sprint(bound))), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(labels, append(values, "+Inf")), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %g\n", h.name, formatLabels(h.labels, values), hist.sum)
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, values), hist.count)
+	}
+}
+
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func splitLabelKey(key string) []string {
+	return strings.Split(key, "\xff")
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func writeHeader(w io.Writer, name, help, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// timeHTTP records how long handler takes to serve each request under path.
+func timeHTTP(path string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		handler(w, r)
+		httpDuration.observe(time.Since(start), path)
+	}
+}
+
+// gameOutcome names how a finished game ended for the games finished counter.
+func gameOutcome(winner, reason string) string {
+	switch {
+	case winner == "draw":
+		return "draw"
+	case reason != "":
+		return reason
+	default:
+		return "win"
+	}
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	writeHeader(w, "minigames_connections_active", "Open websocket connections.", "gauge")
+	fmt.Fprintf(w, "minigames_connections_active %d\n", len(connectedClients()))
+
+	roomCounts := make(map[string]float64)
+	for gameType := range gameRegistry {
+		roomCounts[gameType] = 0
+	}
+	roomsMu.Lock()
+	for _, room := range rooms {
+		roomCounts[room.GameType]++
+	}
+	roomsMu.Unlock()
+
+	writeHeader(w, "minigames_rooms_active", "Rooms currently open, by game type.", "gauge")
+	for _, gameType := range sortedKeys(roomCounts) {
+		fmt.Fprintf(w, "minigames_rooms_active%s %g\n", formatLabels([]string{"game_type"}, []string{gameType}), roomCounts[gameType])
+	}
+
+	messagesReceived.write(w)
+	movesRejected.write(w)
+	gamesFinished.write(w)
+	reconnects.write(w)
+	rateLimited.write(w)
+	roomCleanups.write(w)
+	messageDuration.write(w)
+	httpDuration.write(w)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCounterVecWrite(t *testing.T) {
+	c := newCounterVec("test_total", "A test counter.", "type", "code")
+	c.inc("move", "NOT_YOUR_TURN")
+	c.inc("move", "NOT_YOUR_TURN")
+	c.inc("chat", "say \"hi\"\nback\\slash")
+
+	var buf bytes.Buffer
+	c.write(&buf)
+
+	want := `# HELP test_total A test counter.
+# TYPE test_total counter
+test_total{type="chat",code="say \"hi\"\nback\\slash"} 1
+test_total{type="move",code="NOT_YOUR_TURN"} 2
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCounterVecWriteWithoutLabels(t *testing.T) {
+	c := newCounterVec("test_total", "A test counter.")
+
+	var buf bytes.Buffer
+	c.write(&buf)
+	if !strings.HasSuffix(buf.String(), "\ntest_total 0\n") {
+		t.Errorf("unlabelled counter not written as zero before its first increment:\n%s", buf.String())
+	}
+
+	c.inc()
+	c.inc()
+	buf.Reset()
+	c.write(&buf)
+	if !strings.HasSuffix(buf.String(), "\ntest_total 2\n") {
+		t.Errorf("got\n%s", buf.String())
+	}
+}
+
+func TestHistogramVecWrite(t *testing.T) {
+	h := newHistogramVec("test_seconds", "A test histogram.", "path")
+	h.observe(3*time.Millisecond, "/api")
+	h.observe(2*time.Second, "/api")
+
+	var buf bytes.Buffer
+	h.write(&buf)
+
+	want := `# HELP test_seconds A test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{path="/api",le="0.0005"} 0
+test_seconds_bucket{path="/api",le="0.001"} 0
+test_seconds_bucket{path="/api",le="0.0025"} 0
+test_seconds_bucket{path="/api",le="0.005"} 1
+test_seconds_bucket{path="/api",le="0.01"} 1
+test_seconds_bucket{path="/api",le="0.025"} 1
+test_seconds_bucket{path="/api",le="0.05"} 1
+test_seconds_bucket{path="/api",le="0.1"} 1
+test_seconds_bucket{path="/api",le="0.25"} 1
+test_seconds_bucket{path="/api",le="0.5"} 1
+test_seconds_bucket{path="/api",le="1"} 1
+test_seconds_bucket{path="/api",le="+Inf"} 2
+test_seconds_sum{path="/api"} 2.003
+test_seconds_count{path="/api"} 2
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMessageTypeLabel(t *testing.T) {
+	for msgType, want := range map[string]string{
+		"create":      "create",
+		"dotsMove":    "dotsMove",
+		"rpsChoice":   "rpsChoice",
+		"":            "other",
+		"madeUp12345": "other",
+	} {
+		if got := messageTypeLabel(msgType); got != want {
+			t.Errorf("messageTypeLabel(%q) = %q, want %q", msgType, got, want)
+		}
+	}
+}
+
+// sampleLine matches a sample in the Prometheus text format.
+var sampleLine = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*(\{[a-zA-Z_][a-zA-Z0-9_]*="(\\.|[^"\\])*"(,[a-zA-Z_][a-zA-Z0-9_]*="(\\.|[^"\\])*")*\})? [0-9.e+-]+$`)
+
+func TestHandleMetrics(t *testing.T) {
+	room := newTestRoom(t, GameTypeDots)
+	registerTestRoom(t, room)
+	messagesReceived.inc("chat")
+
+	rec := httptest.NewRecorder()
+	handleMetrics(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("content type %q", ct)
+	}
+
+	body := rec.Body.String()
+	types := make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "# TYPE "):
+			types[strings.Fields(line)[2]]++
+		case strings.HasPrefix(line, "# HELP "):
+		case !sampleLine.MatchString(line):
+			t.Errorf("malformed line %q", line)
+		}
+	}
+
+	for _, name := range []string{
+		"minigames_connections_active",
+		"minigames_rooms_active",
+		"minigames_messages_received_total",
+		"minigames_moves_rejected_total",
+		"minigames_games_finished_total",
+		"minigames_reconnects_total",
+		"minigames_rate_limited_total",
+		"minigames_room_cleanups_total",
+		"minigames_message_handler_duration_seconds",
+		"minigames_http_request_duration_seconds",
+	} {
+		if types[name] != 1 {
+			t.Errorf("%s declared %d times, want once", name, types[name])
+		}
+	}
+
+	for _, want := range []string{
+		"minigames_rooms_active{game_type=\"dots\"} 1\n",
+		"minigames_rooms_active{game_type=\"tictactoe\"} 0\n",
+		"minigames_messages_received_total{type=\"chat\"} ",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("output lacks %q", want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// RoomBans lists who may not join a room again for as long as it exists.
+type RoomBans struct {
+	Usernames map[string]bool
+	IPs       map[string]bool
+}
+
+type ModerationPayload struct {
+	Username string `json:"username"`
+}
+
+type KickedPayload struct {
+	Code   string `json:"code"`
+	By     string `json:"by"`
+	Banned bool   `json:"banned"`
+}
+
+type HostChangedPayload struct {
+	Username string `json:"username"`
+	Previous string `json:"previous"`
+}
+
+func (bans *RoomBans) add(player *Player) {
+	if bans.Usernames == nil {
+		bans.Usernames = make(map[string]bool)
+		bans.IPs = make(map[string]bool)
+	}
+	bans.Usernames[player.Username] = true
+	// Bots, and players restored from a snapshot who have not reconnected
+	// yet, have no address to ban.
+	if ip := player.Conn.IP(); ip != "" {
+		bans.IPs[ip] = true
+	}
+}
+
+func (bans *RoomBans) bans(ws *Client, username string) bool {
+	return bans.Usernames[username] || bans.IPs[ws.IP()]
+}
+
+// playerByUsername returns the client and player using username, or nils.
+func (room *GameRoom) playerByUsername(username string) (*Client, *Player) {
+	for client, player := range room.Players {
+		if player.Username == username {
+			return client, player
+		}
+	}
+	return nil, nil
+}
+
+// lockHostRoom returns the room ws is hosting, locked, along with the player
+// named in msg. It sends the appropriate error and returns a nil room when ws
+// is not the host or the player is not in the room.
+func lockHostRoom(ws *Client, msg Message, action string) (*GameRoom, *Client, *Player) {
+	var payload ModerationPayload
+	if err := msg.decodePayload(&payload); err != nil {
+		sendError(ws, ErrBadMessage, fmt.Sprintf("Invalid %s payload", action))
+		return nil, nil, nil
+	}
+
+	room := findPlayerRoom(ws)
+	if room == nil {
+		sendError(ws, ErrNotInRoom, "You are not in a room")
+		return nil, nil, nil
+	}
+
+	room.mu.Lock()
+	if ws != room.Host {
+		room.mu.Unlock()
+		sendError(ws, ErrNotHost, fmt.Sprintf("Only the host can %s", action))
+		return nil, nil, nil
+	}
+
+	client, player := room.playerByUsername(payload.Username)
+	if player == nil {
+		room.mu.Unlock()
+		sendError(ws, ErrPlayerNotFound, fmt.Sprintf("%s is not in this room", payload.Username))
+		return nil, nil, nil
+	}
+	if client == ws {
+		room.mu.Unlock()
+		sendError(ws, ErrBadMessage, fmt.Sprintf("You cannot %s yourself", action))
+		return nil, nil, nil
+	}
+
+	return room, client, player
+}
+
+func handleKick(ws *Client, msg Message) {
+	room, client, player := lockHostRoom(ws, msg, "kick")
+	if room == nil {
+		return
+	}
+	defer room.mu.Unlock()
+
+	room.removePlayer(client, player, false)
+}
+
+func handleBan(ws *Client, msg Message) {
+	room, client, player := lockHostRoom(ws, msg, "ban")
+	if room == nil {
+		return
+	}
+	defer room.mu.Unlock()
+
+	room.Bans.add(player)
+	room.removePlayer(client, player, true)
+}
+
+func handleTransferHost(ws *Client, msg Message) {
+	room, client, player := lockHostRoom(ws, msg, "transfer host")
+	if room == nil {
+		return
+	}
+	defer room.mu.Unlock()
+
+	if player.Role == RoleSpectator || player.BotLevel != "" || !player.Connected {
+		sendError(ws, ErrBadMessage, fmt.Sprintf("%s cannot become host", player.Username))
+		return
+	}
+
+	room.setHost(client, room.Players[ws].Username)
+}
+
+// removePlayer takes player out of the room on the host's orders. The caller
+// holds room.mu.
+func (room *GameRoom) removePlayer(client *Client, player *Player, banned bool) {
+	host := room.Players[room.Host]
+
+	delete(room.Players, client)
+	clearPlayerRoom(client)
+
+	client.Send(newMessage("kicked", KickedPayload{
+		Code:   room.Code,
+		By:     host.Username,
+		Banned: banned,
+	}))
+
+	slog.Info("Player removed by host", "room", room.Code, "host", host.Username, "username", player.Username, "banned", banned)
+
+	if player.Role != RoleSpectator {
+		room.sendAll(newMessage("playerLeft", PlayerLeftPayload{
+			Player:   player.Role,
+			Username: player.Username,
+		}))
+	}
+	updateLobby(room)
+}
+
+// setHost hands the room over from the host named previous to client and
+// tells everyone. The caller holds room.mu.
+func (room *GameRoom) setHost(client *Client, previous string) {
+	room.Host = client
+
+	slog.Info("Host changed", "room", room.Code, "username", room.Players[client].Username, "previous", previous)
+
+	room.sendAll(newMessage("hostChanged", HostChangedPayload{
+		Username: room.Players[client].Username,
+		Previous: previous,
+	}))
+	updateLobby(room)
+}
+
+// promoteHost picks a connected human to take over from a host who has left,
+// preferring seated players over spectators. It returns false when nobody is
+// left to promote. The caller holds room.mu.
+func (room *GameRoom) promoteHost(previous string) bool {
+	var candidate *Client
+	for client, player := range room.Players {
+		if !player.Connected || player.BotLevel != "" {
+			continue
+		}
+		if player.Role != RoleSpectator {
+			candidate = client
+			break
+		}
+		if candidate == nil {
+			candidate = client
+		}
+	}
+	if candidate == nil {
+		return false
+	}
+
+	room.setHost(candidate, previous)
+	return true
+}
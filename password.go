@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"sync"
+	"time"
+)
+
+const (
+	maxPasswordLength = 64
+
+	// An IP that gets the password wrong maxPasswordFailures times within
+	// passwordFailureWindow is refused until the oldest failure ages out.
+	maxPasswordFailures   = 5
+	passwordFailureWindow = time.Minute
+)
+
+// RoomPassword is a salted hash of a room's join password.
+type RoomPassword struct {
+	Salt []byte
+	Hash []byte
+}
+
+func newRoomPassword(password string) *RoomPassword {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	return &RoomPassword{Salt: salt, Hash: hashPassword(salt, password)}
+}
+
+func hashPassword(salt []byte, password string) []byte {
+	sum := sha256.Sum256(append(append([]byte{}, salt...), password...))
+	return sum[:]
+}
+
+func (p *RoomPassword) matches(password string) bool {
+	return subtle.ConstantTimeCompare(p.Hash, hashPassword(p.Salt, password)) == 1
+}
+
+var (
+	passwordFailures   = make(map[string][]time.Time)
+	passwordFailuresMu sync.Mutex
+)
+
+// passwordThrottled reports whether ip has used up its wrong guesses.
+func passwordThrottled(ip string) bool {
+	passwordFailuresMu.Lock()
+	defer passwordFailuresMu.Unlock()
+
+	failures := recentFailures(ip, time.Now())
+	return len(failures) >= maxPasswordFailures
+}
+
+func recordPasswordFailure(ip string) {
+	passwordFailuresMu.Lock()
+	defer passwordFailuresMu.Unlock()
+
+	now := time.Now()
+	passwordFailures[ip] = append(recentFailures(ip, now), now)
+}
+
+// recentFailures drops ip's failures older than the window and returns the
+// rest. The caller holds passwordFailuresMu.
+func recentFailures(ip string, now time.Time) []time.Time {
+	failures := passwordFailures[ip]
+	for len(failures) > 0 && now.Sub(failures[0]) > passwordFailureWindow {
+		failures = failures[1:]
+	}
+	if len(failures) == 0 {
+		delete(passwordFailures, ip)
+		return nil
+	}
+	passwordFailures[ip] = failures
+	return failures
+}
+
+// prunePasswordFailures forgets every failure that has aged out.
+func prunePasswordFailures() {
+	passwordFailuresMu.Lock()
+	defer passwordFailuresMu.Unlock()
+
+	now := time.Now()
+	for ip := range passwordFailures {
+		recentFailures(ip, now)
+	}
+}
@@ -0,0 +1,79 @@
+// In-room chat shared by the lobby and game pages, which also shows notices
+// from the server administrators. Pages call attachChat with every socket
+// they open; the panel listens on the socket alongside the page's own
+// message handler.
+let chatSocket = null
+
+function attachChat(socket) {
+  if (new URLSearchParams(window.location.search).get("replay")) return
+  chatSocket = socket
+  if (!document.getElementById("chatPanel")) {
+    createChatPanel()
+  }
+  socket.addEventListener("message", (event) => {
+    const msg = JSON.parse(event.data)
+    if (msg.type === "chat") {
+      appendChatMessage(msg.payload)
+    } else if (msg.type === "chatHistory") {
+      document.getElementById("chatMessages").innerHTML = ""
+      msg.payload.messages.forEach(appendChatMessage)
+    } else if (msg.type === "error" && msg.payload.code === "CHAT_TOO_LONG") {
+      appendChatNotice(msg.payload.message)
+    } else if (msg.type === "rateLimited") {
+      appendChatNotice(msg.payload.message)
+    } else if (msg.type === "maintenance") {
+      appendChatNotice(`Server notice: ${msg.payload.message}`)
+    }
+  })
+}
+
+function createChatPanel() {
+  const panel = document.createElement("div")
+  panel.id = "chatPanel"
+  panel.className = "chat-panel"
+  panel.innerHTML = `
+    <div id="chatMessages" class="chat-messages"></div>
+    <div class="chat-input">
+      <input type="text" id="chatInput" placeholder="Say something..." maxlength="300" />
+      <button id="chatSend">Send</button>
+    </div>
+  `
+  document.body.appendChild(panel)
+  document.getElementById("chatSend").addEventListener("click", sendChat)
+  document.getElementById("chatInput").addEventListener("keypress", (e) => {
+    if (e.key === "Enter") {
+      sendChat()
+    }
+  })
+}
+
+function sendChat() {
+  const input = document.getElementById("chatInput")
+  const text = input.value.trim()
+  if (!text || !chatSocket || chatSocket.readyState !== WebSocket.OPEN) return
+  chatSocket.send(JSON.stringify({ type: "chat", payload: { text: text } }))
+  input.value = ""
+}
+
+function appendChatMessage(chat) {
+  const line = document.createElement("div")
+  line.className = "chat-line"
+  const time = new Date(chat.time).toLocaleTimeString([], { hour: "2-digit", minute: "2-digit" })
+  const sender = document.createElement("strong")
+  sender.textContent = chat.role === "spectator" ? `${chat.username} (spectator)` : chat.username
+  line.append(`[${time}] `, sender, `: ${chat.text}`)
+  addChatLine(line)
+}
+
+function appendChatNotice(text) {
+  const line = document.createElement("div")
+  line.className = "chat-line chat-notice"
+  line.textContent = text
+  addChatLine(line)
+}
+
+function addChatLine(line) {
+  const messages = document.getElementById("chatMessages")
+  messages.appendChild(line)
+  messages.scrollTop = messages.scrollHeight
+}
@@ -0,0 +1,85 @@
+// Rooms created with a time limit send a "clock" message at the start of every
+// turn, and a "turnSkipped" one when a turn runs out in a room that skips
+// rather than forfeits. This file shows the countdown under the status line.
+let clockState = null
+let clockReceivedAt = 0
+let clockTicker = null
+let clockNotice = ""
+let clockNoticeUntil = 0
+
+function handleClock(clock) {
+  clockState = clock
+  clockReceivedAt = Date.now()
+  if (!clockTicker) {
+    clockTicker = setInterval(renderClock, 250)
+  }
+  renderClock()
+}
+
+function handleTurnSkipped(data) {
+  clockNotice = `${data.username || data.player} ran out of time - turn skipped`
+  clockNoticeUntil = Date.now() + 4000
+  renderClock()
+}
+
+// stopClockDisplay freezes the countdown once the game is over.
+function stopClockDisplay() {
+  if (!clockState) return
+  clockState.remainingMs = currentRemaining()
+  clockState.turn = ""
+  renderClock()
+}
+
+function currentRemaining() {
+  const remaining = {}
+  Object.keys(clockState.remainingMs).forEach((role) => {
+    let left = clockState.remainingMs[role]
+    if (role === clockState.turn) {
+      left = Math.max(0, left - (Date.now() - clockReceivedAt))
+    }
+    remaining[role] = left
+  })
+  return remaining
+}
+
+function clockElement() {
+  let el = document.getElementById("gameClock")
+  if (!el) {
+    el = document.createElement("div")
+    el.id = "gameClock"
+    el.className = "game-clock"
+    const status = document.getElementById("statusMessage")
+    status.parentNode.insertBefore(el, status.nextSibling)
+  }
+  return el
+}
+
+function renderClock() {
+  if (!clockState) return
+  const el = clockElement()
+  el.innerHTML = ""
+  const remaining = currentRemaining()
+  Object.keys(remaining)
+    .sort()
+    .forEach((role) => {
+      const span = document.createElement("span")
+      span.className = "clock-role"
+      if (role === clockState.turn) {
+        span.classList.add("active")
+        if (remaining[role] < 10000) span.classList.add("low")
+      }
+      span.textContent = `${role} ${formatClock(remaining[role])}`
+      el.appendChild(span)
+    })
+  if (Date.now() < clockNoticeUntil) {
+    const notice = document.createElement("div")
+    notice.className = "clock-notice"
+    notice.textContent = clockNotice
+    el.appendChild(notice)
+  }
+}
+
+function formatClock(ms) {
+  const seconds = Math.ceil(ms / 1000)
+  return `${Math.floor(seconds / 60)}:${String(seconds % 60).padStart(2, "0")}`
+}
@@ -6,6 +6,7 @@ let cells = Array(9).fill(null)
 let gameOver = false
 let isHost = false
 let username = ""
+let serverRestarting = false
 const opponentUsername = ""
 const scores = {
   X: 0,
@@ -19,7 +20,7 @@ document.addEventListener("DOMContentLoaded", () => {
   isHost = sessionStorage.getItem("isHost") === "true"
   username = sessionStorage.getItem("username") || ""
   console.log("Session data:", { gameCode, playerRole, isHost, username })
-  if (!gameCode || !playerRole || !username) {
+  if (!replayId && (!gameCode || !playerRole || !username)) {
     console.error("Missing game session data")
     document.getElementById("statusMessage").textContent = "Error: Game session not found"
     return
@@ -48,15 +49,21 @@ function createBoard() {
 }
 function connectToServer() {
   const protocol = window.location.protocol === "https:" ? "wss:" : "ws:"
-  const wsUrl = `${protocol}//${window.location.hostname}:8080/ws`
+  const wsUrl = `${protocol}//${window.location.host}/ws`
   console.log("Connecting to WebSocket server:", wsUrl)
   socket = new WebSocket(wsUrl)
+  attachChat(socket)
   socket.onopen = () => {
     console.log("WebSocket connection established")
+    serverRestarting = false
+    if (replayId) {
+      startReplay(socket)
+      return
+    }
     socket.send(
       JSON.stringify({
         type: "join",
-        payload: JSON.stringify({ code: gameCode, username: username }),
+        payload: { code: gameCode, username: username, token: sessionStorage.getItem("playerToken") || "" },
         username: username,
       }),
     )
@@ -66,6 +73,10 @@ function connectToServer() {
   }
   socket.onclose = (event) => {
     console.log("WebSocket connection closed:", event)
+    if (serverRestarting) {
+      setTimeout(connectToServer, 3000)
+      return
+    }
     document.getElementById("statusMessage").textContent = "Disconnected from server"
   }
   socket.onerror = (error) => {
@@ -86,22 +97,29 @@ function handleMessage(msg) {
   console.log("Processing message:", msg)
   switch (msg.type) {
     case "roomJoined":
-      handleRoomJoined(JSON.parse(msg.payload))
+      handleRoomJoined(msg.payload)
       break
     case "gameState":
-      handleGameState(JSON.parse(msg.payload))
+      handleGameState(msg.payload)
       break
     case "move":
-      handleMove(JSON.parse(msg.payload), true)
+      handleMove(msg.payload, true)
       break
     case "restart":
       resetGame(true)
       break
     case "gameEnd":
-      handleGameEnd(JSON.parse(msg.payload))
+      stopClockDisplay()
+      handleGameEnd(msg.payload)
+      break
+    case "clock":
+      handleClock(msg.payload)
+      break
+    case "turnSkipped":
+      handleTurnSkipped(msg.payload)
       break
     case "playerLeft":
-      handlePlayerLeft(JSON.parse(msg.payload))
+      handlePlayerLeft(msg.payload)
       break
     case "hostLeft":
       document.getElementById("statusMessage").textContent = "Host left the game - returning to menu"
@@ -109,9 +127,31 @@ function handleMessage(msg) {
         window.location.href = "index.html"
       }, 3000)
       break
+    case "serverShutdown":
+      serverRestarting = true
+      document.getElementById("statusMessage").textContent = msg.payload.message
+      break
+    case "roomClosed":
+      alert(msg.payload.message)
+      window.location.href = "index.html"
+      break
+    case "kicked":
+      alert(msg.payload.banned ? "You have been banned from this room" : "You have been removed from this room")
+      window.location.href = "index.html"
+      break
+    case "hostChanged":
+      isHost = msg.payload.username === username
+      sessionStorage.setItem("isHost", isHost.toString())
+      document.getElementById("restartGame").textContent = isHost ? "New Game" : "Ask Host to Restart"
+      break
+    case "moveRejected":
+      document.getElementById("statusMessage").textContent = `Move rejected: ${msg.payload.reason}`
+      break
     case "error":
-      document.getElementById("statusMessage").textContent = `Error: ${msg.payload}`
+      document.getElementById("statusMessage").textContent = `Error: ${msg.payload.message}`
       break
+    default:
+      handleReplayMessage(msg)
   }
 }
 function handlePlayerLeft(data) {
@@ -123,6 +163,9 @@ function handlePlayerLeft(data) {
 }
 function handleGameState(state) {
   console.log("Received game state:", state)
+  if (state.clock) {
+    handleClock(state.clock)
+  }
   if (state.board) {
     for (let i = 0; i < 9; i++) {
       if (state.board[i]) {
@@ -148,10 +191,13 @@ function handleRoomJoined(data) {
   sessionStorage.setItem("gameCode", gameCode)
   sessionStorage.setItem("playerRole", playerRole)
   sessionStorage.setItem("isHost", isHost.toString())
+  if (data.token) {
+    sessionStorage.setItem("playerToken", data.token)
+  }
   socket.send(
     JSON.stringify({
       type: "getGameState",
-      payload: JSON.stringify({ code: gameCode }),
+      payload: { code: gameCode },
     }),
   )
 }
@@ -176,10 +222,10 @@ function handleCellClick(event) {
   socket.send(
     JSON.stringify({
       type: "move",
-      payload: JSON.stringify({
+      payload: {
         index: index,
         player: playerRole,
-      }),
+      },
     }),
   )
 }
@@ -268,7 +314,7 @@ function requestRestart() {
   socket.send(
     JSON.stringify({
       type: "restart",
-      payload: "",
+      payload: {},
     }),
   )
 }
@@ -306,6 +352,7 @@ function saveUserStats(stats) {
   localStorage.setItem("miniGamesStats", JSON.stringify(stats))
 }
 function updateStats(result) {
+  if (replayId) return
   const stats = getUserStats()
   stats.gamesPlayed++
   if (result === "win") {
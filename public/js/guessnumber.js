@@ -31,7 +31,7 @@ document.addEventListener("DOMContentLoaded", () => {
   isHost = sessionStorage.getItem("isHost") === "true"
   username = sessionStorage.getItem("username") || ""
   console.log("Session data:", { gameCode, playerRole, isHost, username })
-  if (!gameCode || !playerRole || !username) {
+  if (!replayId && (!gameCode || !playerRole || !username)) {
     console.error("Missing game session data")
     document.getElementById("statusMessage").textContent = "Error: Game session not found"
     setTimeout(() => {
@@ -68,16 +68,21 @@ function updatePlayerNames() {
 }
 function connectToServer() {
   const protocol = window.location.protocol === "https:" ? "wss:" : "ws:"
-  const wsUrl = `${protocol}//${window.location.hostname}:8080/ws`
+  const wsUrl = `${protocol}//${window.location.host}/ws`
   console.log("Connecting to WebSocket server:", wsUrl)
   socket = new WebSocket(wsUrl)
+  attachChat(socket)
   socket.onopen = () => {
     console.log("WebSocket connection established")
+    if (replayId) {
+      startReplay(socket)
+      return
+    }
     reconnectAttempts = 0
     socket.send(
       JSON.stringify({
         type: "join",
-        payload: JSON.stringify({ code: gameCode, username: username }),
+        payload: { code: gameCode, username: username, token: sessionStorage.getItem("playerToken") || "" },
         username: username,
       }),
     )
@@ -118,19 +123,19 @@ function handleMessage(msg) {
   console.log("Processing message:", msg)
   switch (msg.type) {
     case "roomJoined":
-      handleRoomJoined(JSON.parse(msg.payload))
+      handleRoomJoined(msg.payload)
       break
     case "gameState":
-      handleGameState(JSON.parse(msg.payload))
+      handleGameState(msg.payload)
       break
     case "letterGuessResult":
-      handleLetterResult(JSON.parse(msg.payload))
+      handleLetterResult(msg.payload)
       break
     case "restart":
       resetGame()
       break
     case "playerLeft":
-      handlePlayerLeft(JSON.parse(msg.payload))
+      handlePlayerLeft(msg.payload)
       break
     case "hostLeft":
       document.getElementById("statusMessage").textContent = "Host left the game - returning to menu"
@@ -138,9 +143,32 @@ function handleMessage(msg) {
         window.location.href = "index.html"
       }, 3000)
       break
+    case "serverShutdown":
+      // The reconnect loop in onclose brings us back once the server is up.
+      reconnectAttempts = 0
+      document.getElementById("statusMessage").textContent = msg.payload.message
+      break
+    case "roomClosed":
+      alert(msg.payload.message)
+      window.location.href = "index.html"
+      break
+    case "kicked":
+      alert(msg.payload.banned ? "You have been banned from this room" : "You have been removed from this room")
+      window.location.href = "index.html"
+      break
+    case "hostChanged":
+      isHost = msg.payload.username === username
+      sessionStorage.setItem("isHost", isHost.toString())
+      document.getElementById("restartGame").textContent = isHost ? "New Game" : "Ask Host to Restart"
+      break
+    case "moveRejected":
+      handleError(msg.payload.reason)
+      break
     case "error":
-      handleError(msg.payload)
+      handleError(msg.payload.message)
       break
+    default:
+      handleReplayMessage(msg)
   }
 }
 function handleError(errorMessage) {
@@ -191,11 +219,14 @@ function handleRoomJoined(data) {
   sessionStorage.setItem("gameCode", gameCode)
   sessionStorage.setItem("playerRole", playerRole)
   sessionStorage.setItem("isHost", isHost.toString())
+  if (data.token) {
+    sessionStorage.setItem("playerToken", data.token)
+  }
   updatePlayerNames()
   socket.send(
     JSON.stringify({
       type: "getGameState",
-      payload: JSON.stringify({ code: gameCode }),
+      payload: { code: gameCode },
     }),
   )
 }
@@ -229,7 +260,7 @@ function submitLetter() {
   socket.send(
     JSON.stringify({
       type: "letterGuess",
-      payload: JSON.stringify({ letter: letter }),
+      payload: { letter: letter },
     }),
   )
   input.value = ""
@@ -327,7 +358,7 @@ function requestRestart() {
   socket.send(
     JSON.stringify({
       type: "restart",
-      payload: "",
+      payload: {},
     }),
   )
 }
@@ -367,6 +398,7 @@ function saveUserStats(stats) {
   localStorage.setItem("miniGamesStats", JSON.stringify(stats))
 }
 function updateStats(result) {
+  if (replayId) return
   const stats = getUserStats()
   stats.gamesPlayed++
   if (result === "win") {
@@ -1,5 +1,8 @@
 let selectedGame = null
 let currentUsername = null
+let roomListSocket = null
+// Games whose pages show the turn clock, so a time limit can be offered.
+const turnGames = ["tictactoe", "connect4", "dots"]
 const gameInfo = {
   tictactoe: {
     title: "Tic Tac Toe",
@@ -37,6 +40,8 @@ document.addEventListener("DOMContentLoaded", () => {
   document.getElementById("changeUsername").addEventListener("click", showUsernameSection)
   document.getElementById("createGame").addEventListener("click", createGame)
   document.getElementById("joinGame").addEventListener("click", joinGame)
+  document.getElementById("playComputer").addEventListener("click", playComputer)
+  document.getElementById("quickMatch").addEventListener("click", quickMatch)
   document.getElementById("usernameInput").addEventListener("keypress", (e) => {
     if (e.key === "Enter") {
       setUsername()
@@ -91,17 +96,95 @@ function selectGame(gameType) {
   const info = gameInfo[gameType]
   document.getElementById("selectedGameTitle").textContent = info.title
   document.getElementById("gameDescription").textContent = info.description
+  const hasComputer = gameType === "tictactoe" || gameType === "connect4"
+  document.getElementById("computerOption").style.display = hasComputer ? "block" : "none"
+  const timeControl = document.getElementById("timeControl")
+  timeControl.style.display = turnGames.includes(gameType) ? "block" : "none"
+  timeControl.value = ""
+  watchOpenRooms(gameType)
 }
 function backToMenu() {
   document.querySelector(".menu").style.display = "grid"
   document.getElementById("gameOptions").style.display = "none"
   selectedGame = null
+  if (roomListSocket) {
+    roomListSocket.close()
+    roomListSocket = null
+  }
+}
+function watchOpenRooms(gameType) {
+  if (roomListSocket) {
+    roomListSocket.close()
+  }
+  renderOpenRooms([])
+  const protocol = window.location.protocol === "https:" ? "wss:" : "ws:"
+  roomListSocket = new WebSocket(`${protocol}//${window.location.host}/ws`)
+  roomListSocket.onopen = () => {
+    roomListSocket.send(JSON.stringify({ type: "listRooms", payload: { gameType: gameType } }))
+  }
+  roomListSocket.onmessage = (event) => {
+    const msg = JSON.parse(event.data)
+    if (msg.type === "roomList" && msg.payload.gameType === selectedGame) {
+      renderOpenRooms(msg.payload.rooms)
+    }
+  }
+}
+function renderOpenRooms(rooms) {
+  const list = document.getElementById("openRooms")
+  list.innerHTML = ""
+  if (rooms.length === 0) {
+    list.innerHTML = '<li class="empty">No open rooms</li>'
+    return
+  }
+  rooms.forEach((room) => {
+    const li = document.createElement("li")
+    const label = document.createElement("span")
+    label.textContent = `${room.host} (${room.players}/${room.maxPlayers})${room.hasPassword ? " 🔒" : ""}`
+    const button = document.createElement("button")
+    button.textContent = "Join"
+    button.addEventListener("click", () => joinRoom(room.code))
+    li.appendChild(label)
+    li.appendChild(button)
+    list.appendChild(li)
+  })
 }
 function createGame() {
   if (!selectedGame) return
+  sessionStorage.removeItem("botDifficulty")
+  sessionStorage.setItem("publicRoom", document.getElementById("publicRoom").checked.toString())
+  sessionStorage.setItem("roomPassword", document.getElementById("roomPassword").value)
+  const timeControl = document.getElementById("timeControl").value
+  if (timeControl && turnGames.includes(selectedGame)) {
+    sessionStorage.setItem("timeControl", timeControl)
+  } else {
+    sessionStorage.removeItem("timeControl")
+  }
   sessionStorage.setItem("gameType", selectedGame)
   sessionStorage.setItem("isHost", "true")
   sessionStorage.setItem("username", currentUsername)
+  sessionStorage.removeItem("playerToken")
+  window.location.href = "lobby.html"
+}
+function playComputer() {
+  if (!selectedGame) return
+  sessionStorage.setItem("gameType", selectedGame)
+  sessionStorage.setItem("isHost", "true")
+  sessionStorage.setItem("username", currentUsername)
+  sessionStorage.removeItem("playerToken")
+  sessionStorage.setItem("botDifficulty", document.getElementById("botDifficulty").value)
+  sessionStorage.removeItem("publicRoom")
+  sessionStorage.removeItem("timeControl")
+  window.location.href = "lobby.html"
+}
+function quickMatch() {
+  if (!selectedGame) return
+  sessionStorage.setItem("gameType", selectedGame)
+  sessionStorage.setItem("isHost", "false")
+  sessionStorage.setItem("username", currentUsername)
+  sessionStorage.setItem("quickMatch", "true")
+  sessionStorage.removeItem("gameCode")
+  sessionStorage.removeItem("playerToken")
+  sessionStorage.removeItem("botDifficulty")
   window.location.href = "lobby.html"
 }
 function joinGame() {
@@ -110,9 +193,13 @@ function joinGame() {
     alert("Please enter a game code!")
     return
   }
+  joinRoom(code)
+}
+function joinRoom(code) {
   sessionStorage.setItem("gameCode", code)
   sessionStorage.setItem("isHost", "false")
   sessionStorage.setItem("username", currentUsername)
+  sessionStorage.removeItem("playerToken")
   window.location.href = "lobby.html"
 }
 function getUserStats() {
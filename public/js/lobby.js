@@ -4,6 +4,7 @@ let playerRole = ""
 let gameType = ""
 let isHost = false
 let username = ""
+let serverRestarting = false
 document.addEventListener("DOMContentLoaded", () => {
   console.log("Lobby page loaded")
   gameType = sessionStorage.getItem("gameType") || "tictactoe"
@@ -37,19 +38,41 @@ function getGameTitle(gameType) {
 }
 function connectToServer() {
   const protocol = window.location.protocol === "https:" ? "wss:" : "ws:"
-  const wsUrl = `${protocol}//${window.location.hostname}:8080/ws`
+  const wsUrl = `${protocol}//${window.location.host}/ws`
   console.log("Connecting to WebSocket server:", wsUrl)
   socket = new WebSocket(wsUrl)
+  attachChat(socket)
   socket.onopen = () => {
     console.log("WebSocket connection established")
     document.getElementById("statusMessage").textContent = "Connected to server"
-    if (isHost) {
+    serverRestarting = false
+    if (sessionStorage.getItem("quickMatch") === "true") {
+      sessionStorage.removeItem("quickMatch")
+      socket.send(
+        JSON.stringify({
+          type: "queue",
+          payload: { gameType: gameType, username: username },
+        }),
+      )
+    } else if (isHost && !gameCode) {
+      // A host coming back after a server restart rejoins below instead.
       console.log("Creating new game:", gameType)
+      const botDifficulty = sessionStorage.getItem("botDifficulty")
+      const isPublic = sessionStorage.getItem("publicRoom") === "true"
+      const password = sessionStorage.getItem("roomPassword") || ""
+      const timeControl = sessionStorage.getItem("timeControl")
+      sessionStorage.removeItem("roomPassword")
+      sessionStorage.removeItem("timeControl")
+      const options = botDifficulty ? { vsComputer: true, difficulty: botDifficulty } : { public: isPublic, password: password }
+      if (timeControl) {
+        options.timeControl = JSON.parse(timeControl)
+      }
       socket.send(
         JSON.stringify({
           type: "create",
           gameType: gameType,
           username: username,
+          payload: options,
         }),
       )
     }
@@ -58,7 +81,7 @@ function connectToServer() {
       socket.send(
         JSON.stringify({
           type: "join",
-          payload: JSON.stringify({ code: gameCode, username: username }),
+          payload: { code: gameCode, username: username, token: sessionStorage.getItem("playerToken") || "" },
           username: username,
         }),
       )
@@ -68,6 +91,10 @@ function connectToServer() {
   }
   socket.onclose = () => {
     console.log("WebSocket connection closed")
+    if (serverRestarting) {
+      setTimeout(connectToServer, 3000)
+      return
+    }
     document.getElementById("statusMessage").textContent = "Disconnected from server"
   }
   socket.onerror = (error) => {
@@ -88,22 +115,56 @@ function handleMessage(msg) {
   console.log("Processing message:", msg)
   switch (msg.type) {
     case "roomCreated":
-      handleRoomCreated(JSON.parse(msg.payload))
+      handleRoomCreated(msg.payload)
       break
     case "roomJoined":
-      handleRoomJoined(JSON.parse(msg.payload))
+      handleRoomJoined(msg.payload)
       break
     case "lobbyUpdate":
-      handleLobbyUpdate(JSON.parse(msg.payload))
+      handleLobbyUpdate(msg.payload)
       break
     case "startGame":
-      handleStartGame(JSON.parse(msg.payload))
+      handleStartGame(msg.payload)
+      break
+    case "serverShutdown":
+      serverRestarting = true
+      document.getElementById("statusMessage").textContent = msg.payload.message
+      break
+    case "roomClosed":
+      alert(msg.payload.message)
+      window.location.href = "index.html"
+      break
+    case "kicked":
+      alert(msg.payload.banned ? "You have been banned from this room" : "You have been removed from this room")
+      window.location.href = "index.html"
+      break
+    case "queueStatus":
+      document.getElementById("statusMessage").textContent =
+        `Finding an opponent... ${msg.payload.waiting} waiting, you are #${msg.payload.position}`
       break
     case "error":
-      handleError(msg.payload)
+      if (msg.payload.code === "PASSWORD_REQUIRED" || msg.payload.code === "WRONG_PASSWORD") {
+        askForPassword(msg.payload.message)
+      } else {
+        handleError(msg.payload.message)
+      }
       break
   }
 }
+function askForPassword(message) {
+  const password = prompt(`${message}\nEnter the room password:`)
+  if (password === null) {
+    window.location.href = "index.html"
+    return
+  }
+  socket.send(
+    JSON.stringify({
+      type: "join",
+      payload: { code: gameCode, username: username, password: password },
+      username: username,
+    }),
+  )
+}
 function handleRoomCreated(data) {
   console.log("Room created:", data)
   gameCode = data.code
@@ -114,6 +175,9 @@ function handleRoomCreated(data) {
   sessionStorage.setItem("playerRole", playerRole)
   sessionStorage.setItem("gameType", gameType)
   sessionStorage.setItem("isHost", isHost.toString())
+  if (data.token) {
+    sessionStorage.setItem("playerToken", data.token)
+  }
   document.getElementById("gameCode").textContent = gameCode
   document.getElementById("statusMessage").textContent =
     `Welcome ${username}! You are ${playerRole} (Host) - You play first!`
@@ -128,25 +192,35 @@ function handleRoomJoined(data) {
   sessionStorage.setItem("playerRole", playerRole)
   sessionStorage.setItem("gameType", gameType)
   sessionStorage.setItem("isHost", isHost.toString())
+  if (data.token) {
+    sessionStorage.setItem("playerToken", data.token)
+  }
   document.getElementById("gameCode").textContent = gameCode
   document.getElementById("statusMessage").textContent =
-    `Welcome ${username}! You are ${playerRole} - Host plays first!`
+    playerRole === "spectator"
+      ? `Welcome ${username}! The room is full - you are watching as a spectator.`
+      : `Welcome ${username}! You are ${playerRole} - Host plays first!`
 }
 function handleLobbyUpdate(data) {
   console.log("Lobby update:", data)
   const playerList = document.getElementById("playerList")
   playerList.innerHTML = ""
   data.players.forEach((player) => {
-    const li = document.createElement("li")
-    li.innerHTML = `
-      <div class="player-info">
-        <span>${player.username}</span>
-        <div>
-          <span class="player-role">${player.role}</span>
-          ${player.isHost ? '<span class="host-badge">HOST</span>' : ""}
-        </div>
-      </div>
-    `
+    const badges = []
+    if (player.rating) badges.push(["player-rating", player.rating])
+    badges.push(["player-role", player.role])
+    if (player.isHost) badges.push(["host-badge", "HOST"])
+    const li = playerListItem(player.username, badges)
+    if (data.isHost && player.username !== username) {
+      li.appendChild(hostControls(player.username, true))
+    }
+    playerList.appendChild(li)
+  })
+  ;(data.spectators || []).forEach((spectator) => {
+    const li = playerListItem(spectator.username, [["player-role", "Spectator"]])
+    if (data.isHost) {
+      li.appendChild(hostControls(spectator.username, false))
+    }
     playerList.appendChild(li)
   })
   if (data.players.length < 2) {
@@ -156,6 +230,39 @@ function handleLobbyUpdate(data) {
     document.getElementById("statusMessage").textContent = `Room ready! Game will start automatically...`
   }
 }
+// Usernames are chosen by visitors, so they only ever go in as text.
+function playerListItem(name, badges) {
+  const li = document.createElement("li")
+  const info = document.createElement("div")
+  info.className = "player-info"
+  const nameSpan = document.createElement("span")
+  nameSpan.textContent = name
+  const badgeList = document.createElement("div")
+  badges.forEach(([className, text]) => {
+    const badge = document.createElement("span")
+    badge.className = className
+    badge.textContent = text
+    badgeList.appendChild(badge)
+  })
+  info.append(nameSpan, badgeList)
+  li.appendChild(info)
+  return li
+}
+function hostControls(target, canHost) {
+  const controls = document.createElement("div")
+  controls.className = "host-controls"
+  const actions = canHost ? ["kick", "ban", "transferHost"] : ["kick", "ban"]
+  const labels = { kick: "Kick", ban: "Ban", transferHost: "Make Host" }
+  actions.forEach((action) => {
+    const button = document.createElement("button")
+    button.textContent = labels[action]
+    button.addEventListener("click", () => {
+      socket.send(JSON.stringify({ type: action, payload: { username: target } }))
+    })
+    controls.appendChild(button)
+  })
+  return controls
+}
 function handleStartGame(data) {
   console.log("Starting game:", data)
   sessionStorage.setItem("gameCode", gameCode)
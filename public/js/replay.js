@@ -0,0 +1,98 @@
+// A game page opened with ?replay=<match id> plays back a stored match instead
+// of joining a room. The server resends the original game messages, so the
+// page's own handlers draw the board; this file only adds the controls.
+const replayId = new URLSearchParams(window.location.search).get("replay")
+let replaySocket = null
+let replayTotalMoves = 0
+let replayPaused = false
+let replayMove = 0
+
+function startReplay(socket) {
+  replaySocket = socket
+  socket.send(
+    JSON.stringify({
+      type: "replay",
+      payload: { id: replayId, speed: 1 },
+    }),
+  )
+  createReplayControls()
+  document.querySelectorAll("#restartGame").forEach((el) => {
+    el.style.display = "none"
+  })
+}
+
+function sendReplayControl(action, extra = {}) {
+  replaySocket.send(
+    JSON.stringify({
+      type: "replayControl",
+      payload: { action: action, ...extra },
+    }),
+  )
+}
+
+function createReplayControls() {
+  const bar = document.createElement("div")
+  bar.id = "replayControls"
+  bar.className = "replay-controls"
+  bar.innerHTML = `
+    <button id="replayBack" title="Step back">&#9664;&#9664;</button>
+    <button id="replayToggle">Pause</button>
+    <button id="replayForward" title="Step forward">&#9654;&#9654;</button>
+    <input id="replaySeek" type="range" min="0" max="0" value="0" />
+    <span id="replayPosition">0 / 0</span>
+    <select id="replaySpeed">
+      <option value="0.5">0.5x</option>
+      <option value="1" selected>1x</option>
+      <option value="2">2x</option>
+      <option value="4">4x</option>
+      <option value="8">8x</option>
+    </select>
+  `
+  const status = document.getElementById("statusMessage")
+  status.parentNode.insertBefore(bar, status.nextSibling)
+
+  document.getElementById("replayBack").addEventListener("click", () => sendReplayControl("stepBack"))
+  document.getElementById("replayForward").addEventListener("click", () => sendReplayControl("stepForward"))
+  document.getElementById("replayToggle").addEventListener("click", () => {
+    if (replayMove >= replayTotalMoves) {
+      sendReplayControl("seek", { move: 0 })
+      sendReplayControl("resume")
+    } else {
+      sendReplayControl(replayPaused ? "resume" : "pause")
+    }
+  })
+  document.getElementById("replaySeek").addEventListener("change", (e) => {
+    sendReplayControl("seek", { move: Number.parseInt(e.target.value) })
+  })
+  document.getElementById("replaySpeed").addEventListener("change", (e) => {
+    sendReplayControl("speed", { speed: Number.parseFloat(e.target.value) })
+  })
+}
+
+// handleReplayMessage handles the replay's own messages and returns whether
+// msg was one of them.
+function handleReplayMessage(msg) {
+  switch (msg.type) {
+    case "replayStarted": {
+      const data = msg.payload
+      replayTotalMoves = data.totalMoves
+      const names = data.players.map((p) => `${p.username} (${p.role})`).join(" vs ")
+      document.title = `Replay: ${names}`
+      document.getElementById("replaySeek").max = replayTotalMoves
+      updateReplayPosition(0)
+      return true
+    }
+    case "replayPosition":
+      replayPaused = msg.payload.paused
+      updateReplayPosition(msg.payload.move)
+      return true
+  }
+  return false
+}
+
+function updateReplayPosition(move) {
+  replayMove = move
+  document.getElementById("replaySeek").value = move
+  document.getElementById("replayPosition").textContent = `${move} / ${replayTotalMoves}`
+  document.getElementById("replayToggle").textContent = replayPaused || move >= replayTotalMoves ? "Play" : "Pause"
+}
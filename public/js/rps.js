@@ -25,7 +25,7 @@ document.addEventListener("DOMContentLoaded", () => {
   isHost = sessionStorage.getItem("isHost") === "true"
   username = sessionStorage.getItem("username") || ""
   console.log("Session data:", { gameCode, playerRole, isHost, username })
-  if (!gameCode || !playerRole || !username) {
+  if (!replayId && (!gameCode || !playerRole || !username)) {
     console.error("Missing game session data")
     document.getElementById("statusMessage").textContent = "Error: Game session not found"
     setTimeout(() => {
@@ -53,16 +53,21 @@ function updatePlayerIndicators() {
 }
 function connectToServer() {
   const protocol = window.location.protocol === "https:" ? "wss:" : "ws:"
-  const wsUrl = `${protocol}//${window.location.hostname}:8080/ws`
+  const wsUrl = `${protocol}//${window.location.host}/ws`
   console.log("Connecting to WebSocket server:", wsUrl)
   socket = new WebSocket(wsUrl)
+  attachChat(socket)
   socket.onopen = () => {
     console.log("WebSocket connection established")
+    if (replayId) {
+      startReplay(socket)
+      return
+    }
     reconnectAttempts = 0
     socket.send(
       JSON.stringify({
         type: "join",
-        payload: JSON.stringify({ code: gameCode, username: username }),
+        payload: { code: gameCode, username: username, token: sessionStorage.getItem("playerToken") || "" },
         username: username,
       }),
     )
@@ -103,16 +108,16 @@ function handleMessage(msg) {
   console.log("Processing message:", msg)
   switch (msg.type) {
     case "roomJoined":
-      handleRoomJoined(JSON.parse(msg.payload))
+      handleRoomJoined(msg.payload)
       break
     case "gameState":
-      handleGameState(JSON.parse(msg.payload))
+      handleGameState(msg.payload)
       break
     case "rpsResult":
-      handleRPSResult(JSON.parse(msg.payload))
+      handleRPSResult(msg.payload)
       break
     case "playerLeft":
-      handlePlayerLeft(JSON.parse(msg.payload))
+      handlePlayerLeft(msg.payload)
       break
     case "hostLeft":
       document.getElementById("statusMessage").textContent = "Host left the game - returning to menu"
@@ -120,9 +125,31 @@ function handleMessage(msg) {
         window.location.href = "index.html"
       }, 3000)
       break
+    case "serverShutdown":
+      // The reconnect loop in onclose brings us back once the server is up.
+      reconnectAttempts = 0
+      document.getElementById("statusMessage").textContent = msg.payload.message
+      break
+    case "roomClosed":
+      alert(msg.payload.message)
+      window.location.href = "index.html"
+      break
+    case "kicked":
+      alert(msg.payload.banned ? "You have been banned from this room" : "You have been removed from this room")
+      window.location.href = "index.html"
+      break
+    case "hostChanged":
+      isHost = msg.payload.username === username
+      sessionStorage.setItem("isHost", isHost.toString())
+      break
+    case "moveRejected":
+      handleError(msg.payload.reason)
+      break
     case "error":
-      handleError(msg.payload)
+      handleError(msg.payload.message)
       break
+    default:
+      handleReplayMessage(msg)
   }
 }
 function handleError(errorMessage) {
@@ -159,6 +186,9 @@ function handleRoomJoined(data) {
   sessionStorage.setItem("gameCode", gameCode)
   sessionStorage.setItem("playerRole", playerRole)
   sessionStorage.setItem("isHost", isHost.toString())
+  if (data.token) {
+    sessionStorage.setItem("playerToken", data.token)
+  }
   updatePlayerIndicators()
 }
 function handleChoiceClick(event) {
@@ -177,7 +207,7 @@ function handleChoiceClick(event) {
   socket.send(
     JSON.stringify({
       type: "rpsChoice",
-      payload: JSON.stringify({ choice: choice }),
+      payload: { choice: choice },
     }),
   )
   document.getElementById("statusMessage").textContent = `You chose ${choice}!`
@@ -198,6 +228,11 @@ function handleRPSResult(result) {
     resultText.className = "result-text draw"
     scores.draw++
     document.getElementById("scoreDraw").textContent = scores.draw
+  } else if (replayId) {
+    resultText.textContent = `Player ${result.winner.slice(-1)} wins this round!`
+    resultText.className = "result-text"
+    scores[result.winner]++
+    document.getElementById(`score${result.winner}`).textContent = scores[result.winner]
   } else if (result.winner === playerRole) {
     resultText.textContent = "You win this round!"
     resultText.className = "result-text win"
@@ -214,6 +249,10 @@ function handleRPSResult(result) {
   }
   currentRound = result.round
   document.getElementById("roundNumber").textContent = `Round ${currentRound}`
+  if (replayId) {
+    document.getElementById("statusMessage").textContent = `Round ${result.round} complete`
+    return
+  }
   document.getElementById("newRound").style.display = "inline-block"
   document.getElementById("statusMessage").textContent = "Round complete! Click 'Next Round' to continue."
 }
@@ -247,6 +286,7 @@ function saveUserStats(stats) {
   localStorage.setItem("miniGamesStats", JSON.stringify(stats))
 }
 function updateStats(result) {
+  if (replayId) return
   const stats = getUserStats()
   stats.gamesPlayed++
   if (result === "win") {
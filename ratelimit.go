@@ -0,0 +1,215 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket allows bursts of up to capacity events, refilled at rate tokens
+// per second.
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	rate     float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(capacity, rate float64) *tokenBucket {
+	return &tokenBucket{capacity: capacity, rate: rate, tokens: capacity, last: time.Now()}
+}
+
+// allow takes a token if one is available.
+func (b *tokenBucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// retryAfter returns how long until the next token is available.
+func (b *tokenBucket) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tokens := b.tokens + time.Since(b.last).Seconds()*b.rate
+	if tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tokens) / b.rate * float64(time.Second))
+}
+
+type rateLimit struct {
+	burst float64
+	rate  float64 // per second
+}
+
+// messageRateLimits caps how often a connection may send each type of
+// message. Types not listed are game moves and share moveRateLimit.
+var messageRateLimits = map[string]rateLimit{
+	"create":        {3, 0.1},
+	"join":          {5, 0.5},
+	"restart":       {3, 0.2},
+	"getGameState":  {10, 2},
+	"replay":        {3, 0.2},
+	"replayControl": {20, 5},
+	"listRooms":     {5, 0.5},
+	"unlistRooms":   {5, 0.5},
+	"queue":         {3, 0.2},
+	"cancelQueue":   {3, 0.2},
+	"kick":          {5, 0.5},
+	"ban":           {5, 0.5},
+	"transferHost":  {5, 0.5},
+	"chat":          {chatBurst, chatRate},
+	"other":         {5, 0.5},
+}
+
+var moveRateLimit = rateLimit{10, 2}
+
+const (
+	// Everyone behind one address shares buckets ipRateLimitFactor times the
+	// size of a single connection's, leaving room for a few tabs or a
+	// household behind NAT.
+	ipRateLimitFactor = 4
+	ipLimiterIdle     = 10 * time.Minute
+
+	// A connection is dropped once it has sent more than maxRateStrikes
+	// rate-limited messages faster than one per strikeRecovery.
+	maxRateStrikes = 20
+	strikeRecovery = 1.0 // strikes forgiven per second
+)
+
+// messageLimiter holds one token bucket per message type.
+type messageLimiter struct {
+	mu      sync.Mutex
+	factor  float64
+	buckets map[string]*tokenBucket
+}
+
+func newMessageLimiter(factor float64) *messageLimiter {
+	return &messageLimiter{factor: factor, buckets: make(map[string]*tokenBucket)}
+}
+
+// bucket returns the bucket for msgType, which must already be one of the
+// bounded labels from messageTypeLabel.
+func (l *messageLimiter) bucket(msgType string) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket := l.buckets[msgType]
+	if bucket == nil {
+		limit, ok := messageRateLimits[msgType]
+		if !ok {
+			limit = moveRateLimit
+		}
+		bucket = newTokenBucket(limit.burst*l.factor, limit.rate*l.factor)
+		l.buckets[msgType] = bucket
+	}
+	return bucket
+}
+
+type ipLimiter struct {
+	limiter  *messageLimiter
+	lastSeen time.Time
+}
+
+var (
+	ipLimiters   = make(map[string]*ipLimiter)
+	ipLimitersMu sync.Mutex
+)
+
+func limiterForIP(ip string) *messageLimiter {
+	ipLimitersMu.Lock()
+	defer ipLimitersMu.Unlock()
+
+	entry := ipLimiters[ip]
+	if entry == nil {
+		entry = &ipLimiter{limiter: newMessageLimiter(ipRateLimitFactor)}
+		ipLimiters[ip] = entry
+	}
+	entry.lastSeen = time.Now()
+	return entry.limiter
+}
+
+// pruneIPLimiters forgets addresses that have been quiet long enough for
+// their buckets to have refilled.
+func pruneIPLimiters() {
+	ipLimitersMu.Lock()
+	defer ipLimitersMu.Unlock()
+
+	for ip, entry := range ipLimiters {
+		if time.Since(entry.lastSeen) > ipLimiterIdle {
+			delete(ipLimiters, ip)
+		}
+	}
+}
+
+// roomsCreatedBy counts the open rooms created from ip. The caller holds
+// roomsMu.
+func roomsCreatedBy(ip string) int {
+	count := 0
+	for _, room := range rooms {
+		if room.CreatorIP == ip {
+			count++
+		}
+	}
+	return count
+}
+
+type RateLimitedPayload struct {
+	Type         string `json:"type"`
+	Message      string `json:"message"`
+	RetryAfterMs int    `json:"retryAfterMs"`
+	Disconnect   bool   `json:"disconnect"`
+}
+
+// allowMessage charges a message of type msgType, a label from
+// messageTypeLabel, to both the connection's and its address's buckets. A
+// refused message earns the connection a strike, and a connection that runs
+// out of strikes is told so and disconnected. It is only called from the
+// connection's read loop.
+func allowMessage(ws *Client, msgType string) bool {
+	own := ws.limiter.bucket(msgType)
+	shared := limiterForIP(ws.IP()).bucket(msgType)
+
+	// Check the connection's own bucket first so one noisy tab does not
+	// drain the tokens of the others behind the same address.
+	if own.allow() && shared.allow() {
+		return true
+	}
+
+	rateLimited.inc(msgType)
+
+	wait := own.retryAfter()
+	if shared := shared.retryAfter(); shared > wait {
+		wait = shared
+	}
+	payload := RateLimitedPayload{
+		Type:         msgType,
+		Message:      "You are sending messages too quickly",
+		RetryAfterMs: int(wait / time.Millisecond),
+	}
+
+	if !ws.strikes.allow() {
+		payload.Message = "Too many messages. You have been disconnected."
+		payload.Disconnect = true
+		ws.Send(newMessage("rateLimited", payload))
+		ws.logger().Warn("Disconnecting client for flooding", "type", msgType)
+		ws.Close()
+		return false
+	}
+
+	ws.Send(newMessage("rateLimited", payload))
+	return false
+}
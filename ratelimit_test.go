@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// rewind makes the bucket behave as if d had passed since it was last used.
+func (b *tokenBucket) rewind(d time.Duration) {
+	b.mu.Lock()
+	b.last = b.last.Add(-d)
+	b.mu.Unlock()
+}
+
+func TestTokenBucketBurst(t *testing.T) {
+	b := newTokenBucket(3, 0.001)
+	for i := 0; i < 3; i++ {
+		if !b.allow() {
+			t.Fatalf("event %d of a burst of 3 refused", i+1)
+		}
+	}
+	if b.allow() {
+		t.Error("event beyond the burst allowed")
+	}
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		allowed int
+	}{
+		{"no time", 0, 0},
+		{"half a token", 250 * time.Millisecond, 0},
+		{"one token", 500 * time.Millisecond, 1},
+		{"three tokens", 1500 * time.Millisecond, 3},
+		{"capped at capacity", time.Hour, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTokenBucket(4, 2)
+			for b.allow() {
+			}
+			b.rewind(tt.elapsed)
+
+			allowed := 0
+			for b.allow() {
+				allowed++
+			}
+			if allowed != tt.allowed {
+				t.Errorf("%d events allowed after %v, want %d", allowed, tt.elapsed, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestTokenBucketRetryAfter(t *testing.T) {
+	b := newTokenBucket(2, 4)
+	if wait := b.retryAfter(); wait != 0 {
+		t.Errorf("full bucket says retry after %v", wait)
+	}
+
+	b.allow()
+	b.allow()
+	// Emptied, a token is a quarter of a second away at 4 per second.
+	if wait := b.retryAfter(); wait <= 200*time.Millisecond || wait > 250*time.Millisecond {
+		t.Errorf("empty bucket says retry after %v, want just under 250ms", wait)
+	}
+
+	b.rewind(100 * time.Millisecond)
+	if wait := b.retryAfter(); wait <= 100*time.Millisecond || wait > 150*time.Millisecond {
+		t.Errorf("after 100ms the bucket says retry after %v, want just under 150ms", wait)
+	}
+
+	b.rewind(time.Second)
+	if wait := b.retryAfter(); wait != 0 {
+		t.Errorf("refilled bucket says retry after %v", wait)
+	}
+}
+
+func TestMessageLimiterBuckets(t *testing.T) {
+	l := newMessageLimiter(ipRateLimitFactor)
+
+	if l.bucket("chat") != l.bucket("chat") {
+		t.Error("a message type got a new bucket on every call")
+	}
+	if l.bucket("chat") == l.bucket("create") {
+		t.Error("two message types share a bucket")
+	}
+
+	create := l.bucket("create")
+	if want := messageRateLimits["create"].burst * ipRateLimitFactor; create.capacity != want {
+		t.Errorf("create bucket holds %v, want %v", create.capacity, want)
+	}
+	move := l.bucket("dotsMove")
+	if move.capacity != moveRateLimit.burst*ipRateLimitFactor || move.rate != moveRateLimit.rate*ipRateLimitFactor {
+		t.Errorf("move bucket is %v at %v/s, want the move limit scaled by %d", move.capacity, move.rate, ipRateLimitFactor)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	initialRating = 1200
+	ratingK       = 32
+
+	// Ratings are written out at most once per ratingSaveDelay, so a burst
+	// of quick games such as rock paper scissors rounds costs one write.
+	ratingSaveDelay = 2 * time.Second
+)
+
+// ratedGames are the head to head games that move players' ratings.
+var ratedGames = map[string]bool{
+	GameTypeTicTacToe: true,
+	GameTypeConnect4:  true,
+	GameTypeRPS:       true,
+	GameTypeDots:      true,
+}
+
+type Rating struct {
+	Rating float64 `json:"rating"`
+	Games  int     `json:"games"`
+}
+
+// RatingStore holds an Elo rating per game type per username and keeps them
+// in a single JSON file.
+type RatingStore struct {
+	path    string
+	mu      sync.Mutex
+	ratings map[string]map[string]*Rating
+
+	saveTimer *time.Timer // set while a save is scheduled; guarded by mu
+	saveMu    sync.Mutex  // held while writing the file
+}
+
+var ratingStore *RatingStore
+
+func openRatingStore(path string) (*RatingStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	store := &RatingStore{path: path, ratings: make(map[string]map[string]*Rating)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.ratings); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Get returns username's rating for gameType, or the starting rating for a
+// player who has not finished a rated game yet.
+func (store *RatingStore) Get(gameType, username string) Rating {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if rating := store.ratings[gameType][username]; rating != nil {
+		return *rating
+	}
+	return Rating{Rating: initialRating}
+}
+
+// Update applies the result of one game between a and b, where score is 1 if
+// a won, 0 if b won and 0.5 for a draw, and schedules the new ratings to be
+// saved. It never waits on the disk, since callers hold a room lock.
+func (store *RatingStore) Update(gameType, a, b string, score float64) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	ratingA := store.rating(gameType, a)
+	ratingB := store.rating(gameType, b)
+
+	expected := 1 / (1 + math.Pow(10, (ratingB.Rating-ratingA.Rating)/400))
+	delta := ratingK * (score - expected)
+
+	ratingA.Rating += delta
+	ratingB.Rating -= delta
+	ratingA.Games++
+	ratingB.Games++
+
+	if store.saveTimer == nil {
+		store.saveTimer = time.AfterFunc(ratingSaveDelay, store.Flush)
+	}
+}
+
+func (store *RatingStore) rating(gameType, username string) *Rating {
+	byUser := store.ratings[gameType]
+	if byUser == nil {
+		byUser = make(map[string]*Rating)
+		store.ratings[gameType] = byUser
+	}
+	rating := byUser[username]
+	if rating == nil {
+		rating = &Rating{Rating: initialRating}
+		byUser[username] = rating
+	}
+	return rating
+}
+
+// Flush writes the ratings to disk now if a save is scheduled.
+func (store *RatingStore) Flush() {
+	// saveMu keeps an older snapshot from being written over a newer one.
+	store.saveMu.Lock()
+	defer store.saveMu.Unlock()
+
+	store.mu.Lock()
+	if store.saveTimer == nil {
+		store.mu.Unlock()
+		return
+	}
+	store.saveTimer.Stop()
+	store.saveTimer = nil
+	data, err := json.MarshalIndent(store.ratings, "", "  ")
+	store.mu.Unlock()
+
+	if err == nil {
+		err = store.write(data)
+	}
+	if err != nil {
+		slog.Error("Error saving ratings", "err", err)
+	}
+}
+
+func (store *RatingStore) write(data []byte) error {
+	tmp := store.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, store.path)
+}
+
+// ratingFor returns the rating shown next to player in the lobby, or 0 when
+// the room's game is unrated or the player is a bot.
+func (room *GameRoom) ratingFor(player *Player) int {
+	if ratingStore == nil || !ratedGames[room.GameType] || player.BotLevel != "" {
+		return 0
+	}
+	return int(math.Round(ratingStore.Get(room.GameType, player.Username).Rating))
+}
+
+// updateRatings moves the seated players' ratings after a rated game ends
+// with winner, a role or "draw". Games against the computer are not rated.
+func (room *GameRoom) updateRatings(winner string) {
+	if ratingStore == nil || !ratedGames[room.GameType] {
+		return
+	}
+
+	roles := room.GameState.Roles()
+	a, b := room.playerForRole(roles[0]), room.playerForRole(roles[1])
+	if a == nil || b == nil || a.BotLevel != "" || b.BotLevel != "" {
+		return
+	}
+
+	score := 0.5
+	switch winner {
+	case a.Role:
+		score = 1
+	case b.Role:
+		score = 0
+	}
+
+	ratingStore.Update(room.GameType, a.Username, b.Username, score)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRatingStoreSavesLater(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratings.json")
+	store, err := openRatingStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		store.Update(GameTypeRPS, "alice", "bob", 1)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("ratings were written while the game was finishing: %v", err)
+	}
+
+	store.mu.Lock()
+	scheduled := store.saveTimer != nil
+	store.mu.Unlock()
+	if !scheduled {
+		t.Fatal("no save was scheduled")
+	}
+
+	store.Flush()
+	reopened, err := openRatingStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, bob := reopened.Get(GameTypeRPS, "alice"), reopened.Get(GameTypeRPS, "bob")
+	if alice.Games != 5 || bob.Games != 5 || alice.Rating <= initialRating || math.Abs(alice.Rating+bob.Rating-2*initialRating) > 1e-9 {
+		t.Errorf("saved ratings are %+v and %+v, want five games won by alice", alice, bob)
+	}
+
+	// Nothing is pending any more, so flushing again leaves the file alone.
+	os.Remove(path)
+	store.Flush()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("flushing with nothing pending wrote the file: %v", err)
+	}
+}
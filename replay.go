@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	ReplayPause       = "pause"
+	ReplayResume      = "resume"
+	ReplaySeek        = "seek"
+	ReplayStepBack    = "stepBack"
+	ReplayStepForward = "stepForward"
+	ReplaySpeed       = "speed"
+	ReplayStop        = "stop"
+
+	minReplaySpeed = 0.25
+	maxReplaySpeed = 32.0
+)
+
+// ReplaySession plays a stored match back to one client by resending the
+// messages the room originally received, so game pages render it with their
+// usual handlers.
+type ReplaySession struct {
+	client   *Client
+	record   *MatchRecord
+	controls chan ReplayControlPayload
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// Owned by the run goroutine.
+	pos    int
+	speed  float64
+	paused bool
+}
+
+type ReplayRequestPayload struct {
+	ID    string  `json:"id"`
+	Speed float64 `json:"speed"`
+}
+
+type ReplayControlPayload struct {
+	Action string  `json:"action"`
+	Move   int     `json:"move"`
+	Speed  float64 `json:"speed"`
+}
+
+type ReplayStartedPayload struct {
+	ID         string        `json:"id"`
+	GameType   string        `json:"gameType"`
+	Players    []MatchPlayer `json:"players"`
+	Result     *MatchResult  `json:"result"`
+	TotalMoves int           `json:"totalMoves"`
+	Speed      float64       `json:"speed"`
+}
+
+type ReplayPositionPayload struct {
+	Move       int     `json:"move"`
+	TotalMoves int     `json:"totalMoves"`
+	Paused     bool    `json:"paused"`
+	Speed      float64 `json:"speed"`
+}
+
+var (
+	replaySessions   = make(map[*Client]*ReplaySession)
+	replaySessionsMu sync.Mutex
+)
+
+func validReplaySpeed(speed float64) bool {
+	return speed >= minReplaySpeed && speed <= maxReplaySpeed
+}
+
+// handleReplay starts playing a stored match to ws, replacing any replay it
+// was already watching.
+func handleReplay(ws *Client, msg Message) {
+	var request ReplayRequestPayload
+	if err := msg.decodePayload(&request); err != nil {
+		sendError(ws, ErrBadMessage, "Invalid replay payload")
+		return
+	}
+	if request.Speed == 0 {
+		request.Speed = 1
+	}
+	if !validReplaySpeed(request.Speed) {
+		sendError(ws, ErrBadMessage, fmt.Sprintf("speed must be between %g and %g", minReplaySpeed, maxReplaySpeed))
+		return
+	}
+
+	record, err := matchStore.Get(request.ID)
+	if err != nil {
+		sendError(ws, ErrReplayNotFound, fmt.Sprintf("Match %s not found", request.ID))
+		return
+	}
+
+	session := &ReplaySession{
+		client:   ws,
+		record:   record,
+		controls: make(chan ReplayControlPayload, 8),
+		stop:     make(chan struct{}),
+		speed:    request.Speed,
+	}
+
+	replaySessionsMu.Lock()
+	if old := replaySessions[ws]; old != nil {
+		old.Stop()
+	}
+	replaySessions[ws] = session
+	replaySessionsMu.Unlock()
+
+	go session.run()
+}
+
+// handleReplayControl forwards a pause, seek or speed change to the replay
+// ws is watching.
+func handleReplayControl(ws *Client, msg Message) {
+	var control ReplayControlPayload
+	if err := msg.decodePayload(&control); err != nil {
+		sendError(ws, ErrBadMessage, "Invalid replay control payload")
+		return
+	}
+
+	switch control.Action {
+	case ReplayPause, ReplayResume, ReplaySeek, ReplayStepBack, ReplayStepForward, ReplayStop:
+	case ReplaySpeed:
+		if !validReplaySpeed(control.Speed) {
+			sendError(ws, ErrBadMessage, fmt.Sprintf("speed must be between %g and %g", minReplaySpeed, maxReplaySpeed))
+			return
+		}
+	default:
+		sendError(ws, ErrBadMessage, fmt.Sprintf("Unknown replay action %s", control.Action))
+		return
+	}
+
+	replaySessionsMu.Lock()
+	session := replaySessions[ws]
+	replaySessionsMu.Unlock()
+
+	if session == nil {
+		sendError(ws, ErrReplayNotFound, "No replay in progress")
+		return
+	}
+
+	select {
+	case session.controls <- control:
+	default:
+		// The session is busy; the client will retry from its controls.
+	}
+}
+
+func (session *ReplaySession) Stop() {
+	session.stopOnce.Do(func() { close(session.stop) })
+}
+
+func (session *ReplaySession) run() {
+	defer func() {
+		replaySessionsMu.Lock()
+		if replaySessions[session.client] == session {
+			delete(replaySessions, session.client)
+		}
+		replaySessionsMu.Unlock()
+	}()
+
+	session.client.Send(newMessage("replayStarted", ReplayStartedPayload{
+		ID:         session.record.ID,
+		GameType:   session.record.GameType,
+		Players:    session.record.Players,
+		Result:     session.record.Result,
+		TotalMoves: len(session.record.Events),
+		Speed:      session.speed,
+	}))
+	session.seek(0)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	session.schedule(timer)
+
+	for {
+		select {
+		case <-timer.C:
+			session.playNext()
+			session.sendPosition()
+			session.schedule(timer)
+
+		case control := <-session.controls:
+			switch control.Action {
+			case ReplayPause:
+				session.paused = true
+			case ReplayResume:
+				session.paused = false
+			case ReplaySpeed:
+				session.speed = control.Speed
+			case ReplaySeek:
+				session.seek(control.Move)
+			case ReplayStepBack:
+				session.paused = true
+				session.seek(session.pos - 1)
+			case ReplayStepForward:
+				session.paused = true
+				session.playNext()
+			case ReplayStop:
+				return
+			}
+			session.sendPosition()
+			session.schedule(timer)
+
+		case <-session.stop:
+			return
+		case <-session.client.done:
+			return
+		}
+	}
+}
+
+// schedule arms timer for the next event, keeping the gap between moves as
+// it was in the original game divided by the playback speed.
+func (session *ReplaySession) schedule(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+
+	events := session.record.Events
+	if session.paused || session.pos >= len(events) {
+		return
+	}
+
+	previous := session.record.StartedAt
+	if session.pos > 0 {
+		previous = events[session.pos-1].Time
+	}
+	gap := events[session.pos].Time.Sub(previous)
+	if gap < 0 {
+		gap = 0
+	}
+	timer.Reset(time.Duration(float64(gap) / session.speed))
+}
+
+// seek redraws the game as it stood after move n. The board is restored from
+// the state before move n and move n itself is resent so the page shows it
+// the way it did live.
+func (session *ReplaySession) seek(n int) {
+	events := session.record.Events
+	if n < 0 {
+		n = 0
+	}
+	if n > len(events) {
+		n = len(events)
+	}
+
+	state := session.record.InitialState
+	if n >= 2 {
+		state = events[n-2].State
+	}
+
+	session.client.Send(newMessage("restart", nil))
+	session.client.Send(Message{Version: protocolVersion, Type: "gameState", Payload: state})
+
+	session.pos = 0
+	if n > 0 {
+		session.pos = n - 1
+		session.playNext()
+	}
+}
+
+func (session *ReplaySession) playNext() {
+	events := session.record.Events
+	if session.pos >= len(events) {
+		return
+	}
+
+	for _, msg := range events[session.pos].Messages {
+		// Clock readings were only meaningful while the game was live.
+		if msg.Type == "clock" {
+			continue
+		}
+		session.client.Send(msg)
+	}
+	session.pos++
+}
+
+func (session *ReplaySession) sendPosition() {
+	session.client.Send(newMessage("replayPosition", ReplayPositionPayload{
+		Move:       session.pos,
+		TotalMoves: len(session.record.Events),
+		Paused:     session.paused,
+		Speed:      session.speed,
+	}))
+}
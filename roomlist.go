@@ -0,0 +1,169 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RoomListing describes a public room with a free seat.
+type RoomListing struct {
+	Code        string `json:"code"`
+	GameType    string `json:"gameType"`
+	Host        string `json:"host"`
+	Players     int    `json:"players"`
+	MaxPlayers  int    `json:"maxPlayers"`
+	Spectators  int    `json:"spectators"`
+	AgeSeconds  int    `json:"ageSeconds"`
+	HasPassword bool   `json:"hasPassword"`
+}
+
+type RoomListPayload struct {
+	GameType string        `json:"gameType,omitempty"`
+	Rooms    []RoomListing `json:"rooms"`
+}
+
+var (
+	// roomListSubscribers maps every client watching the room list to the
+	// game type it is filtering on, or "" for all games.
+	roomListSubscribers   = make(map[*Client]string)
+	roomListSubscribersMu sync.Mutex
+
+	roomListChanged = make(chan struct{}, 1)
+)
+
+// notifyRoomList schedules a fresh room list for every subscriber. It never
+// blocks, so it is safe to call with any room locks held.
+func notifyRoomList() {
+	select {
+	case roomListChanged <- struct{}{}:
+	default:
+	}
+}
+
+// roomListRoutine pushes the room list to subscribers whenever a room is
+// created, changes occupancy or goes away.
+func roomListRoutine() {
+	for range roomListChanged {
+		listings := publicRooms("")
+
+		roomListSubscribersMu.Lock()
+		for client, gameType := range roomListSubscribers {
+			client.Send(newMessage("roomList", RoomListPayload{
+				GameType: gameType,
+				Rooms:    filterListings(listings, gameType),
+			}))
+		}
+		roomListSubscribersMu.Unlock()
+	}
+}
+
+// publicRooms lists the open public rooms, oldest first, optionally only
+// those of one game type. It must be called without any room lock held.
+func publicRooms(gameType string) []RoomListing {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+
+	listings := make([]RoomListing, 0)
+	for _, room := range rooms {
+		if !room.Public || (gameType != "" && room.GameType != gameType) {
+			continue
+		}
+
+		room.mu.Lock()
+		if room.nextFreeRole() != "" {
+			listing := RoomListing{
+				Code:        room.Code,
+				GameType:    room.GameType,
+				MaxPlayers:  len(room.GameState.Roles()),
+				AgeSeconds:  int(time.Since(room.CreatedAt).Seconds()),
+				HasPassword: room.Password != nil,
+			}
+			if host := room.Players[room.Host]; host != nil {
+				listing.Host = host.Username
+			}
+			for _, player := range room.Players {
+				if player.Role == RoleSpectator {
+					listing.Spectators++
+				} else {
+					listing.Players++
+				}
+			}
+			listings = append(listings, listing)
+		}
+		room.mu.Unlock()
+	}
+
+	sort.Slice(listings, func(i, j int) bool {
+		return listings[i].AgeSeconds > listings[j].AgeSeconds
+	})
+	return listings
+}
+
+func filterListings(listings []RoomListing, gameType string) []RoomListing {
+	if gameType == "" {
+		return listings
+	}
+	filtered := make([]RoomListing, 0)
+	for _, listing := range listings {
+		if listing.GameType == gameType {
+			filtered = append(filtered, listing)
+		}
+	}
+	return filtered
+}
+
+// handleListRooms subscribes ws to the public room list, optionally filtered
+// by game type, and sends the current list straight away.
+func handleListRooms(ws *Client, msg Message) {
+	var request struct {
+		GameType string `json:"gameType"`
+	}
+	if err := msg.decodePayload(&request); err != nil {
+		sendError(ws, ErrBadMessage, "Invalid listRooms payload")
+		return
+	}
+	if request.GameType == "" {
+		request.GameType = msg.GameType
+	}
+	if request.GameType != "" {
+		if _, ok := gameRegistry[request.GameType]; !ok {
+			sendError(ws, ErrUnknownGameType, "Unknown game type "+request.GameType)
+			return
+		}
+	}
+
+	roomListSubscribersMu.Lock()
+	roomListSubscribers[ws] = request.GameType
+	roomListSubscribersMu.Unlock()
+
+	ws.Send(newMessage("roomList", RoomListPayload{
+		GameType: request.GameType,
+		Rooms:    publicRooms(request.GameType),
+	}))
+}
+
+func unsubscribeRoomList(ws *Client) {
+	roomListSubscribersMu.Lock()
+	delete(roomListSubscribers, ws)
+	roomListSubscribersMu.Unlock()
+}
+
+// handleRoomsAPI serves GET /api/rooms?game=.
+func handleRoomsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Use GET")
+		return
+	}
+
+	gameType := r.URL.Query().Get("game")
+	if gameType != "" {
+		if _, ok := gameRegistry[gameType]; !ok {
+			writeJSONError(w, http.StatusBadRequest, ErrUnknownGameType, "Unknown game type "+gameType)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, publicRooms(gameType))
+}
@@ -0,0 +1,98 @@
+package main
+
+type RPSState struct {
+	Choices map[string]string
+	Round   int
+}
+
+type RPSResultPayload struct {
+	P1     string `json:"p1"`
+	P2     string `json:"p2"`
+	Winner string `json:"winner"`
+	Round  int    `json:"round"`
+}
+
+func init() {
+	registerGame(GameTypeRPS, func() Game {
+		return &RPSState{
+			Choices: make(map[string]string),
+			Round:   1,
+		}
+	})
+}
+
+func (state *RPSState) Roles() []string {
+	return []string{"P1", "P2"}
+}
+
+func (state *RPSState) MoveTypes() []string {
+	return []string{"rpsChoice"}
+}
+
+func (state *RPSState) State() interface{} {
+	return struct {
+		Choices map[string]string `json:"choices"`
+		Round   int               `json:"round"`
+	}{state.Choices, state.Round}
+}
+
+// IsOver is always false: rounds are played back to back in the same room.
+func (state *RPSState) IsOver() bool {
+	return false
+}
+
+func (state *RPSState) Restart() {
+	state.Choices = make(map[string]string)
+	state.Round++
+}
+
+func (state *RPSState) ApplyMove(room *GameRoom, player *Player, msg Message) error {
+	var choice struct {
+		Choice string `json:"choice"`
+	}
+	if err := msg.decodePayload(&choice); err != nil {
+		return errMalformedMove
+	}
+
+	switch choice.Choice {
+	case "rock", "paper", "scissors":
+	default:
+		return rejectMove(ErrInvalidMove, "Choice must be rock, paper or scissors")
+	}
+
+	if _, chosen := state.Choices[player.Role]; chosen {
+		return rejectMove(ErrInvalidMove, "You already made your choice this round")
+	}
+
+	state.Choices[player.Role] = choice.Choice
+
+	if len(state.Choices) < 2 {
+		return nil
+	}
+
+	p1Choice := state.Choices["P1"]
+	p2Choice := state.Choices["P2"]
+
+	var result string
+	if p1Choice == p2Choice {
+		result = "draw"
+	} else if (p1Choice == "rock" && p2Choice == "scissors") ||
+		(p1Choice == "paper" && p2Choice == "rock") ||
+		(p1Choice == "scissors" && p2Choice == "paper") {
+		result = "P1"
+	} else {
+		result = "P2"
+	}
+
+	room.sendAll(newMessage("rpsResult", RPSResultPayload{
+		P1:     p1Choice,
+		P2:     p2Choice,
+		Winner: result,
+		Round:  state.Round,
+	}))
+	room.gameFinished(result, "")
+
+	state.Choices = make(map[string]string)
+	state.Round++
+	return nil
+}
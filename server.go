@@ -1,12 +1,21 @@
 package main
 
 import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -29,113 +38,133 @@ const (
 	GameTypeDots        = "dots"
 )
 
+// RoleSpectator is given to everyone who joins a room once all of the game's
+// seats are taken. Spectators receive every broadcast but cannot play.
+const RoleSpectator = "spectator"
+
 type Player struct {
-	Conn     *websocket.Conn
-	Username string
-	Role     string
+	Conn      *Client
+	Username  string
+	Role      string
+	Token     string
+	Connected bool
+	BotLevel  string // difficulty of a computer player, empty for humans
 }
 
 type GameRoom struct {
 	Code      string
 	GameType  string
-	Players   map[*websocket.Conn]*Player
-	GameState interface{}
-	Host      *websocket.Conn
+	Players   map[*Client]*Player
+	GameState Game
+	Clock     *TurnClock
+	Record    *MatchRecord
+	Public    bool
+	Password  *RoomPassword
+	Bans      RoomBans
+	Chat      []ChatMessage
+	Host      *Client
+	CreatorIP string
 	CreatedAt time.Time
 	mu        sync.Mutex
-}
-
-type Message struct {
-	Type     string `json:"type"`
-	Payload  string `json:"payload"`
-	GameType string `json:"gameType,omitempty"`
-	Code     string `json:"code,omitempty"`
-	Username string `json:"username,omitempty"`
-}
 
-type TicTacToeState struct {
-	Board       [9]string
-	CurrentTurn string
-	GameActive  bool
-}
-
-type RPSState struct {
-	Choices map[string]string
-	Round   int
-}
-
-type Connect4State struct {
-	Board       [6][7]string
-	CurrentTurn string
-	GameActive  bool
-}
-
-type GuessNumberState struct {
-	TargetNumber int
-	Guesses      map[string][]int
-	MaxGuesses   int
-	GameActive   bool
-	Winner       string
-}
-
-type WordGuessState struct {
-	Word            string
-	GuessedWord     []string
-	GuessedLetters  []string
-	WrongGuesses    int
-	MaxWrongGuesses int
-	GameActive      bool
-	CurrentTurn     string
-}
-
-type DotsState struct {
-	Grid        [4][4]bool
-	Lines       []Line
-	Boxes       [3][3]string
-	CurrentTurn string
-	GameActive  bool
-	Scores      map[string]int
-}
-
-type Line struct {
-	StartX, StartY, EndX, EndY int
-	Player                     string
+	// clockPaused is set on rooms restored after a restart until everyone
+	// has rejoined and the clock runs again.
+	clockPaused bool
+	// started is set once every seat has been filled for the first time.
+	// Players taking a seat freed later join the game in progress.
+	started bool
 }
 
 var (
 	rooms     = make(map[string]*GameRoom)
 	roomsMu   sync.Mutex
 	broadcast = make(chan Message)
-)
 
-var wordList = []string{
-	"JAVASCRIPT", "COMPUTER", "PROGRAMMING", "WEBSITE", "INTERNET", "KEYBOARD",
-	"MONITOR", "SOFTWARE", "HARDWARE", "DATABASE", "NETWORK", "SECURITY",
-	"ALGORITHM", "FUNCTION", "VARIABLE", "OBJECT", "ARRAY", "STRING",
-	"BOOLEAN", "INTEGER", "FRAMEWORK", "LIBRARY", "BROWSER", "SERVER",
-}
+	// playerRooms maps every client holding a seat or watching a game to its
+	// room. playerRoomsMu is always the last lock taken.
+	playerRooms   = make(map[*Client]*GameRoom)
+	playerRoomsMu sync.RWMutex
+)
 
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
 func main() {
-	http.Handle("/", http.FileServer(http.Dir("./public")))
+	cfg, err := loadConfig(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		fatal("Error loading config", err)
+	}
+	config = cfg
+	setupLogging(config)
+	config.log()
+
+	http.Handle("/", http.FileServer(http.Dir(config.PublicDir)))
 	http.HandleFunc("/ws", handleConnections)
+	http.HandleFunc("/api/matches", timeHTTP("/api/matches", handleListMatches))
+	http.HandleFunc("/api/matches/", timeHTTP("/api/matches/", handleGetMatch))
+	http.HandleFunc("/api/leaderboard", timeHTTP("/api/leaderboard", handleLeaderboard))
+	http.HandleFunc("/api/players/", timeHTTP("/api/players/", handlePlayerStats))
+	http.HandleFunc("/api/rooms", timeHTTP("/api/rooms", handleRoomsAPI))
+	http.HandleFunc("/metrics", handleMetrics)
+	http.HandleFunc("/healthz", handleHealthz)
+	http.HandleFunc("/readyz", handleReadyz)
+	http.HandleFunc("/api/admin/rooms", timeHTTP("/api/admin/rooms", requireAdmin(handleAdminRooms)))
+	http.HandleFunc("/api/admin/rooms/", timeHTTP("/api/admin/rooms/", requireAdmin(handleAdminRoom)))
+	http.HandleFunc("/api/admin/broadcast", timeHTTP("/api/admin/broadcast", requireAdmin(handleAdminBroadcast)))
+
+	store, err := openMatchStore(filepath.Join(config.DataDir, "matches"))
+	if err != nil {
+		fatal("Error opening match history", err)
+	}
+	matchStore = store
+
+	ratings, err := openRatingStore(filepath.Join(config.DataDir, "ratings.json"))
+	if err != nil {
+		fatal("Error opening ratings", err)
+	}
+	ratingStore = ratings
+
+	if err := loadChatFilter(config.ChatFilter); err != nil {
+		fatal("Error loading chat filter", err)
+	}
+
+	snapshotPath := filepath.Join(config.DataDir, "rooms.json")
+	if err := restoreRooms(snapshotPath); err != nil {
+		fatal("Error restoring rooms", err)
+	}
 
 	go handleMessages()
 	go roomCleanupRoutine()
+	go roomListRoutine()
+	go matchmakingRoutine()
 
-	fmt.Println("Server running on http://localhost:8080")
-	log.Println("Access via local network at http://(Your IP):8080")
-	err := http.ListenAndServe(":8080", nil)
-	if err != nil {
-		log.Fatal("Error starting server:", err)
+	_, port, _ := net.SplitHostPort(config.Addr)
+	slog.Info("Server running", "url", "http://localhost:"+port)
+
+	srv := &http.Server{
+		Addr:     config.Addr,
+		ErrorLog: slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
 	}
+	serverReady.Store(true)
+	go func() {
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			fatal("Error starting server", err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	sig := <-stop
+	slog.Info("Shutting down", "signal", sig.String())
+	shutdown(srv, snapshotPath)
 }
 
 func roomCleanupRoutine() {
-	ticker := time.NewTicker(1 * time.Minute)
+	ticker := time.NewTicker(config.CleanupInterval)
 	defer ticker.Stop()
 
 	for {
@@ -145,80 +174,110 @@ func roomCleanupRoutine() {
 			now := time.Now()
 			for code, room := range rooms {
 				room.mu.Lock()
-				if len(room.Players) == 0 && now.Sub(room.CreatedAt) > 5*time.Minute {
-					delete(rooms, code)
-					log.Printf("Cleaned up empty room: %s", code)
+				if len(room.Players) == 0 && now.Sub(room.CreatedAt) > config.EmptyRoomExpiry {
+					deleteRoom(room)
+					roomCleanups.inc()
+					slog.Info("Cleaned up empty room", "room", code)
 				}
 				room.mu.Unlock()
 			}
 			roomsMu.Unlock()
+			prunePasswordFailures()
+			pruneIPLimiters()
 		}
 	}
 }
 
 func handleConnections(w http.ResponseWriter, r *http.Request) {
-	ws, err := upgrader.Upgrade(w, r, nil)
+	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("Error upgrading connection: %v", err)
+		slog.Warn("Error upgrading connection", "remote", r.RemoteAddr, "err", err)
 		return
 	}
 
-	log.Printf("New client connected from %s", ws.RemoteAddr())
-
-	ws.SetReadDeadline(time.Now().Add(60 * time.Second))
-	ws.SetPongHandler(func(string) error {
-		ws.SetReadDeadline(time.Now().Add(60 * time.Second))
+	conn.SetReadLimit(config.MaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(config.PongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(config.PongWait))
 		return nil
 	})
 
-	go func() {
-		ticker := time.NewTicker(30 * time.Second)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				if err := ws.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(10*time.Second)); err != nil {
-					log.Printf("Ping error: %v", err)
-					return
-				}
-			}
-		}
-	}()
+	ws := newClient(conn)
+	defer ws.Close()
+	ws.logger().Info("Client connected")
 
 	for {
-		var msg Message
-		err := ws.ReadJSON(&msg)
+		_, data, err := conn.ReadMessage()
 		if err != nil {
+			ws.Close()
+			unsubscribeRoomList(ws)
+			leaveQueue(ws)
 			handleDisconnect(ws)
-			log.Printf("Client disconnected: %v", err)
+			ws.logger().Info("Client disconnected", "err", err)
 			break
 		}
 
-		log.Printf("Received message: %+v", msg)
-
-		switch msg.Type {
-		case "create":
-			handleCreateRoom(ws, msg)
-		case "join":
-			handleJoinRoom(ws, msg)
-		case "move":
-			handleGameMove(ws, msg)
-		case "restart":
-			handleGameRestart(ws, msg)
-		case "rpsChoice":
-			handleRPSChoice(ws, msg)
-		case "getGameState":
-			handleGetGameState(ws, msg)
-		case "connect4Move":
-			handleConnect4Move(ws, msg)
-		case "numberGuess":
-			handleNumberGuess(ws, msg)
-		case "letterGuess":
-			handleLetterGuess(ws, msg)
-		case "dotsMove":
-			handleDotsMove(ws, msg)
-		}
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			messagesReceived.inc("invalid")
+			if allowMessage(ws, "other") {
+				sendError(ws, ErrBadMessage, "Message is not valid JSON")
+			}
+			continue
+		}
+
+		// Redacting means decoding the payload again, so only do it when
+		// the line is going to be written.
+		if ws.logger().Enabled(context.Background(), slog.LevelDebug) {
+			ws.msgLogger(msg).Debug("Received message", "payload", redactPayload(msg.payloadJSON()))
+		}
+		label := messageTypeLabel(msg.Type)
+		messagesReceived.inc(label)
+
+		if !allowMessage(ws, label) {
+			continue
+		}
+
+		start := time.Now()
+		handleMessage(ws, msg)
+		messageDuration.observe(time.Since(start), label)
+	}
+}
+
+// handleMessage routes msg to the handler for its type. Anything that isn't a
+// control message is taken to be a game move.
+func handleMessage(ws *Client, msg Message) {
+	switch msg.Type {
+	case "create":
+		handleCreateRoom(ws, msg)
+	case "join":
+		handleJoinRoom(ws, msg)
+	case "restart":
+		handleGameRestart(ws, msg)
+	case "getGameState":
+		handleGetGameState(ws, msg)
+	case "replay":
+		handleReplay(ws, msg)
+	case "replayControl":
+		handleReplayControl(ws, msg)
+	case "listRooms":
+		handleListRooms(ws, msg)
+	case "unlistRooms":
+		unsubscribeRoomList(ws)
+	case "queue":
+		handleQueue(ws, msg)
+	case "cancelQueue":
+		handleCancelQueue(ws)
+	case "kick":
+		handleKick(ws, msg)
+	case "ban":
+		handleBan(ws, msg)
+	case "transferHost":
+		handleTransferHost(ws, msg)
+	case "chat":
+		handleChat(ws, msg)
+	default:
+		handleGameMove(ws, msg)
 	}
 }
 
@@ -231,105 +290,145 @@ func generateRoomCode() string {
 	return string(code)
 }
 
-func handleCreateRoom(ws *websocket.Conn, msg Message) {
-	roomsMu.Lock()
-	defer roomsMu.Unlock()
+// generateToken returns an opaque session token that lets a player reclaim
+// their seat after a reconnect.
+func generateToken() string {
+	b := make([]byte, 16)
+	if _, err := crand.Read(b); err != nil {
+		slog.Error("Error generating session token", "err", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// newRoom builds an empty room for gameType hosted by host, under a code no
+// other room is using. The room is not registered yet. The caller holds
+// roomsMu.
+func newRoom(gameType string, host *Client) (*GameRoom, bool) {
+	game, ok := newGame(gameType)
+	if !ok {
+		return nil, false
+	}
 
 	code := generateRoomCode()
 	for rooms[code] != nil {
 		code = generateRoomCode()
 	}
 
+	return &GameRoom{
+		Code:      code,
+		GameType:  gameType,
+		Players:   make(map[*Client]*Player),
+		GameState: game,
+		Host:      host,
+		CreatedAt: time.Now(),
+	}, true
+}
+
+func handleCreateRoom(ws *Client, msg Message) {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+
 	gameType := msg.GameType
 	if gameType == "" {
 		gameType = GameTypeTicTacToe
 	}
 
-	room := &GameRoom{
-		Code:      code,
-		GameType:  gameType,
-		Players:   make(map[*websocket.Conn]*Player),
-		Host:      ws,
-		CreatedAt: time.Now(),
+	var options struct {
+		VsComputer  bool         `json:"vsComputer"`
+		Difficulty  string       `json:"difficulty"`
+		TimeControl *TimeControl `json:"timeControl"`
+		Public      bool         `json:"public"`
+		Password    string       `json:"password"`
 	}
+	msg.decodePayload(&options)
 
-	switch gameType {
-	case GameTypeTicTacToe:
-		room.GameState = TicTacToeState{
-			Board:       [9]string{},
-			CurrentTurn: "X",
-			GameActive:  true,
-		}
-		room.Players[ws] = &Player{Conn: ws, Username: msg.Username, Role: "X"}
-	case GameTypeRPS:
-		room.GameState = RPSState{
-			Choices: make(map[string]string),
-			Round:   1,
-		}
-		room.Players[ws] = &Player{Conn: ws, Username: msg.Username, Role: "P1"}
-	case GameTypeConnect4:
-		room.GameState = Connect4State{
-			Board:       [6][7]string{},
-			CurrentTurn: "Red",
-			GameActive:  true,
-		}
-		room.Players[ws] = &Player{Conn: ws, Username: msg.Username, Role: "Red"}
-	case GameTypeGuessNumber:
-		room.GameState = GuessNumberState{
-			TargetNumber: rand.Intn(100) + 1,
-			Guesses:      make(map[string][]int),
-			MaxGuesses:   10,
-			GameActive:   true,
+	if findPlayerRoom(ws) != nil {
+		sendError(ws, ErrAlreadyInRoom, "Leave your current room before creating another")
+		return
+	}
+
+	ip := ws.IP()
+	if roomsCreatedBy(ip) >= config.MaxRoomsPerIP {
+		sendError(ws, ErrTooManyRooms, fmt.Sprintf("Your address already has %d open rooms. Please close one first.", config.MaxRoomsPerIP))
+		return
+	}
+
+	room, ok := newRoom(gameType, ws)
+	if !ok {
+		sendError(ws, ErrUnknownGameType, fmt.Sprintf("Unknown game type %s", gameType))
+		return
+	}
+	room.Public = options.Public
+	room.CreatorIP = ip
+
+	if options.Password != "" {
+		if len(options.Password) > maxPasswordLength {
+			sendError(ws, ErrInvalidPassword, fmt.Sprintf("Password must be at most %d characters", maxPasswordLength))
+			return
 		}
-		room.Players[ws] = &Player{Conn: ws, Username: msg.Username, Role: "P1"}
-	case GameTypeWordGuess:
-		word := wordList[rand.Intn(len(wordList))]
-		guessedWord := make([]string, len(word))
-		for i := range guessedWord {
-			guessedWord[i] = "_"
+		room.Password = newRoomPassword(options.Password)
+	}
+	game := room.GameState
+	code := room.Code
+
+	if options.TimeControl != nil {
+		if _, ok := game.(TurnGame); !ok {
+			sendError(ws, ErrInvalidTimeControl, fmt.Sprintf("%s has no turns to time", gameType))
+			return
 		}
-		room.GameState = WordGuessState{
-			Word:            word,
-			GuessedWord:     guessedWord,
-			GuessedLetters:  []string{},
-			WrongGuesses:    0,
-			MaxWrongGuesses: 6,
-			GameActive:      true,
-			CurrentTurn:     "P1",
+		if err := options.TimeControl.validate(); err != nil {
+			sendError(ws, ErrInvalidTimeControl, fmt.Sprintf("Invalid time control: %v", err))
+			return
 		}
-		room.Players[ws] = &Player{Conn: ws, Username: msg.Username, Role: "P1"}
-	case GameTypeDots:
-		room.GameState = DotsState{
-			Grid:        [4][4]bool{},
-			Lines:       []Line{},
-			Boxes:       [3][3]string{},
-			CurrentTurn: "P1",
-			GameActive:  true,
-			Scores:      map[string]int{"P1": 0, "P2": 0},
+		room.Clock = newTurnClock(*options.TimeControl)
+	}
+
+	room.Players[ws] = &Player{
+		Conn:      ws,
+		Username:  msg.Username,
+		Role:      game.Roles()[0],
+		Token:     generateToken(),
+		Connected: true,
+	}
+
+	if options.VsComputer {
+		if err := addBot(room, options.Difficulty); err != nil {
+			sendError(ws, ErrBotUnavailable, fmt.Sprintf("Cannot play against the computer: %v", err))
+			return
 		}
-		room.Players[ws] = &Player{Conn: ws, Username: msg.Username, Role: "P1"}
 	}
 
 	rooms[code] = room
+	setPlayerRoom(ws, room)
+	leaveQueueForRoom(ws)
 
-	log.Printf("Room created: %s, GameType: %s, Host: %s (%s)", code, gameType, msg.Username, room.Players[ws].Role)
+	ws.msgLogger(msg).Info("Room created", "game", gameType, "role", room.Players[ws].Role)
 
-	response := Message{
-		Type: "roomCreated",
-		Payload: fmt.Sprintf(`{"code":"%s","role":"%s","gameType":"%s","isHost":true,"username":"%s"}`,
-			code, room.Players[ws].Role, gameType, msg.Username),
-	}
-	ws.WriteJSON(response)
+	ws.Send(newMessage("roomCreated", RoomJoinedPayload{
+		Code:     code,
+		Role:     room.Players[ws].Role,
+		GameType: gameType,
+		IsHost:   true,
+		Username: msg.Username,
+		Token:    room.Players[ws].Token,
+	}))
 
 	updateLobby(room)
+
+	if room.nextFreeRole() == "" {
+		startGame(room)
+		room.playBotTurns()
+	}
 }
 
-func handleJoinRoom(ws *websocket.Conn, msg Message) {
+func handleJoinRoom(ws *Client, msg Message) {
 	var payload struct {
 		Code     string `json:"code"`
 		Username string `json:"username"`
+		Token    string `json:"token"`
+		Password string `json:"password"`
 	}
-	json.Unmarshal([]byte(msg.Payload), &payload)
+	msg.decodePayload(&payload)
 	code := payload.Code
 	username := payload.Username
 
@@ -337,164 +436,167 @@ func handleJoinRoom(ws *websocket.Conn, msg Message) {
 		username = msg.Username
 	}
 
-	log.Printf("User %s attempting to join room: %s", username, code)
+	logger := ws.msgLogger(msg).With("room", code, "username", username)
+	logger.Debug("Joining room")
 
+	// Held throughout so that matchmaking cannot seat ws elsewhere between
+	// the check below and taking the seat.
 	roomsMu.Lock()
-	room, exists := rooms[code]
-	roomsMu.Unlock()
+	defer roomsMu.Unlock()
 
+	room, exists := rooms[code]
 	if !exists {
-		log.Printf("Room %s not found", code)
-		ws.WriteJSON(Message{
-			Type:    "error",
-			Payload: fmt.Sprintf("Room %s not found. The room may have been closed or expired.", code),
-		})
+		logger.Info("Room not found")
+		sendError(ws, ErrRoomNotFound, fmt.Sprintf("Room %s not found. The room may have been closed or expired.", code))
+		return
+	}
+
+	// A client holds one seat at a time: the room index has room for one.
+	if current := findPlayerRoom(ws); current != nil && current != room {
+		sendError(ws, ErrAlreadyInRoom, "Leave your current room before joining another")
 		return
 	}
 
 	room.mu.Lock()
 	defer room.mu.Unlock()
 
-	for conn, player := range room.Players {
-		if player.Username == username {
-			log.Printf("Player %s reconnecting to room %s as %s", player.Username, code, player.Role)
+	if payload.Token != "" {
+		for conn, player := range room.Players {
+			if player.Token != payload.Token {
+				continue
+			}
+
+			logger.Info("Player reconnected", "role", player.Role)
+			reconnects.inc()
 
 			delete(room.Players, conn)
 			room.Players[ws] = player
 			player.Conn = ws
+			player.Connected = true
+			clearPlayerRoom(conn)
+			setPlayerRoom(ws, room)
+			leaveQueueForRoom(ws)
 
 			if conn == room.Host {
 				room.Host = ws
 			}
+			if conn != ws {
+				conn.Close()
+			}
 
 			isHost := (ws == room.Host)
-			ws.WriteJSON(Message{
-				Type: "roomJoined",
-				Payload: fmt.Sprintf(`{"code":"%s","role":"%s","gameType":"%s","isHost":%t,"username":"%s"}`,
-					code, player.Role, room.GameType, isHost, player.Username),
-			})
+			ws.Send(newMessage("roomJoined", RoomJoinedPayload{
+				Code:     code,
+				Role:     player.Role,
+				GameType: room.GameType,
+				IsHost:   isHost,
+				Username: player.Username,
+				Token:    player.Token,
+			}))
 
 			sendGameState(ws, room)
+			sendChatHistory(ws, room)
 			updateLobby(room)
+			room.resumeClock()
 			return
 		}
 	}
 
-	if len(room.Players) >= 2 {
-		log.Printf("Room %s is full", code)
-		ws.WriteJSON(Message{Type: "error", Payload: "Room is full"})
+	if _, seated := room.Players[ws]; seated {
+		sendError(ws, ErrAlreadyInRoom, fmt.Sprintf("You are already in room %s", code))
 		return
 	}
 
-	var role string
-	switch room.GameType {
-	case GameTypeTicTacToe:
-		role = "O"
-	case GameTypeRPS:
-		role = "P2"
-	case GameTypeConnect4:
-		role = "Yellow"
-	case GameTypeGuessNumber, GameTypeWordGuess, GameTypeDots:
-		role = "P2"
+	if room.Bans.bans(ws, username) {
+		sendError(ws, ErrBanned, fmt.Sprintf("You have been banned from room %s", code))
+		return
 	}
 
-	room.Players[ws] = &Player{
-		Conn:     ws,
-		Username: username,
-		Role:     role,
+	// Reconnects above carry a token instead, so only newcomers need this.
+	if room.Password != nil {
+		ip := ws.IP()
+		if passwordThrottled(ip) {
+			sendError(ws, ErrTooManyAttempts, "Too many wrong passwords. Please wait a minute and try again.")
+			return
+		}
+		if payload.Password == "" {
+			sendError(ws, ErrPasswordRequired, fmt.Sprintf("Room %s requires a password", code))
+			return
+		}
+		if !room.Password.matches(payload.Password) {
+			recordPasswordFailure(ip)
+			logger.Warn("Wrong room password", "ip", ip)
+			sendError(ws, ErrWrongPassword, fmt.Sprintf("Wrong password for room %s", code))
+			return
+		}
 	}
 
-	log.Printf("Player %s joined room %s as %s", username, code, role)
+	for _, player := range room.Players {
+		if player.Username != username {
+			continue
+		}
+
+		if player.Connected {
+			sendError(ws, ErrUsernameTaken, fmt.Sprintf("Username %s is already in use in room %s. Please choose another name.", username, code))
+		} else {
+			sendError(ws, ErrUsernameTaken, fmt.Sprintf("Username %s is reserved for a disconnected player. Rejoin with your session token to reclaim the seat.", username))
+		}
+		return
+	}
 
-	response := Message{
-		Type: "roomJoined",
-		Payload: fmt.Sprintf(`{"code":"%s","role":"%s","gameType":"%s","isHost":false,"username":"%s"}`,
-			code, role, room.GameType, username),
+	role := room.nextFreeRole()
+	if role == "" {
+		role = RoleSpectator
 	}
-	ws.WriteJSON(response)
+
+	room.Players[ws] = &Player{
+		Conn:      ws,
+		Username:  username,
+		Role:      role,
+		Token:     generateToken(),
+		Connected: true,
+	}
+	setPlayerRoom(ws, room)
+	leaveQueueForRoom(ws)
+
+	logger.Info("Player joined", "role", role)
+
+	ws.Send(newMessage("roomJoined", RoomJoinedPayload{
+		Code:     code,
+		Role:     role,
+		GameType: room.GameType,
+		IsHost:   false,
+		Username: username,
+		Token:    room.Players[ws].Token,
+	}))
 
 	sendGameState(ws, room)
+	sendChatHistory(ws, room)
 	updateLobby(room)
 
-	if len(room.Players) == 2 {
+	if role == RoleSpectator {
+		sendStartGame(ws, room)
+	} else if room.nextFreeRole() == "" {
 		startGame(room)
 	}
 }
 
-func sendGameState(ws *websocket.Conn, room *GameRoom) {
-	switch room.GameType {
-	case GameTypeTicTacToe:
-		state := room.GameState.(TicTacToeState)
-		boardJSON, _ := json.Marshal(state.Board)
-		gameStateMsg := Message{
-			Type: "gameState",
-			Payload: fmt.Sprintf(`{"board":%s,"currentTurn":"%s","gameActive":%t}`,
-				boardJSON, state.CurrentTurn, state.GameActive),
-		}
-		ws.WriteJSON(gameStateMsg)
-	case GameTypeRPS:
-		state := room.GameState.(RPSState)
-		choicesJSON, _ := json.Marshal(state.Choices)
-		gameStateMsg := Message{
-			Type: "gameState",
-			Payload: fmt.Sprintf(`{"choices":%s,"round":%d}`,
-				choicesJSON, state.Round),
-		}
-		ws.WriteJSON(gameStateMsg)
-	case GameTypeConnect4:
-		state := room.GameState.(Connect4State)
-		boardJSON, _ := json.Marshal(state.Board)
-		gameStateMsg := Message{
-			Type: "gameState",
-			Payload: fmt.Sprintf(`{"board":%s,"currentTurn":"%s","gameActive":%t}`,
-				boardJSON, state.CurrentTurn, state.GameActive),
-		}
-		ws.WriteJSON(gameStateMsg)
-	case GameTypeGuessNumber:
-		state := room.GameState.(GuessNumberState)
-		guessesJSON, _ := json.Marshal(state.Guesses)
-		gameStateMsg := Message{
-			Type: "gameState",
-			Payload: fmt.Sprintf(`{"guesses":%s,"maxGuesses":%d,"gameActive":%t,"winner":"%s"}`,
-				guessesJSON, state.MaxGuesses, state.GameActive, state.Winner),
-		}
-		ws.WriteJSON(gameStateMsg)
-	case GameTypeWordGuess:
-		state := room.GameState.(WordGuessState)
-		guessedWordJSON, _ := json.Marshal(state.GuessedWord)
-		guessedLettersJSON, _ := json.Marshal(state.GuessedLetters)
-		gameStateMsg := Message{
-			Type: "gameState",
-			Payload: fmt.Sprintf(`{"guessedWord":%s,"guessedLetters":%s,"wrongGuesses":%d,"maxWrongGuesses":%d,"gameActive":%t,"currentTurn":"%s"}`,
-				guessedWordJSON, guessedLettersJSON, state.WrongGuesses, state.MaxWrongGuesses, state.GameActive, state.CurrentTurn),
-		}
-		ws.WriteJSON(gameStateMsg)
-	case GameTypeDots:
-		state := room.GameState.(DotsState)
-		linesJSON, _ := json.Marshal(state.Lines)
-		boxesJSON, _ := json.Marshal(state.Boxes)
-		scoresJSON, _ := json.Marshal(state.Scores)
-		gameStateMsg := Message{
-			Type: "gameState",
-			Payload: fmt.Sprintf(`{"lines":%s,"boxes":%s,"scores":%s,"currentTurn":"%s","gameActive":%t}`,
-				linesJSON, boxesJSON, scoresJSON, state.CurrentTurn, state.GameActive),
-		}
-		ws.WriteJSON(gameStateMsg)
-	}
+func sendGameState(ws *Client, room *GameRoom) {
+	ws.Send(newMessage("gameState", gameStateWithClock(room)))
 }
 
-func handleGetGameState(ws *websocket.Conn, msg Message) {
+func handleGetGameState(ws *Client, msg Message) {
 	var payload struct {
 		Code string `json:"code"`
 	}
-	json.Unmarshal([]byte(msg.Payload), &payload)
+	msg.decodePayload(&payload)
 
 	roomsMu.Lock()
 	room, exists := rooms[payload.Code]
 	roomsMu.Unlock()
 
 	if !exists {
-		ws.WriteJSON(Message{Type: "error", Payload: "Room not found"})
+		sendError(ws, ErrRoomNotFound, "Room not found")
 		return
 	}
 
@@ -503,7 +605,7 @@ func handleGetGameState(ws *websocket.Conn, msg Message) {
 
 	_, isInRoom := room.Players[ws]
 	if !isInRoom {
-		ws.WriteJSON(Message{Type: "error", Payload: "You are not in this room"})
+		sendError(ws, ErrNotInRoom, "You are not in this room")
 		return
 	}
 
@@ -511,551 +613,186 @@ func handleGetGameState(ws *websocket.Conn, msg Message) {
 }
 
 func updateLobby(room *GameRoom) {
-	type PlayerInfo struct {
-		Username string `json:"username"`
-		Role     string `json:"role"`
-		IsHost   bool   `json:"isHost"`
-	}
-
 	players := make([]PlayerInfo, 0, len(room.Players))
+	spectators := make([]PlayerInfo, 0)
 	for conn, player := range room.Players {
 		isHost := (conn == room.Host)
-		players = append(players, PlayerInfo{
+		info := PlayerInfo{
 			Username: player.Username,
 			Role:     player.Role,
 			IsHost:   isHost,
-		})
+			Rating:   room.ratingFor(player),
+		}
+		if player.Role == RoleSpectator {
+			spectators = append(spectators, info)
+		} else {
+			players = append(players, info)
+		}
 	}
 
-	playersJSON, _ := json.Marshal(players)
 	for client, player := range room.Players {
 		isHost := (client == room.Host)
-		client.WriteJSON(Message{
-			Type: "lobbyUpdate",
-			Payload: fmt.Sprintf(`{"code":"%s","players":%s,"gameType":"%s","isHost":%t,"username":"%s"}`,
-				room.Code, playersJSON, room.GameType, isHost, player.Username),
-		})
+		client.Send(newMessage("lobbyUpdate", LobbyUpdatePayload{
+			Code:       room.Code,
+			Players:    players,
+			Spectators: spectators,
+			GameType:   room.GameType,
+			IsHost:     isHost,
+			Username:   player.Username,
+		}))
 	}
-}
 
-func startGame(room *GameRoom) {
-	for client, player := range room.Players {
-		isHost := (client == room.Host)
-		client.WriteJSON(Message{
-			Type: "startGame",
-			Payload: fmt.Sprintf(`{"code":"%s","gameType":"%s","isHost":%t,"username":"%s"}`,
-				room.Code, room.GameType, isHost, player.Username),
-		})
+	if room.Public {
+		notifyRoomList()
 	}
 }
 
-func handleConnect4Move(ws *websocket.Conn, msg Message) {
-	roomCode := findPlayerRoom(ws)
-	if roomCode == "" {
-		return
-	}
-
-	roomsMu.Lock()
-	room := rooms[roomCode]
-	roomsMu.Unlock()
-
-	if room == nil {
-		return
-	}
-
-	room.mu.Lock()
-	defer room.mu.Unlock()
-
-	state, ok := room.GameState.(Connect4State)
-	if !ok || !state.GameActive {
-		return
-	}
-
-	var move struct {
-		Column int `json:"column"`
-	}
-	json.Unmarshal([]byte(msg.Payload), &move)
-
-	player := room.Players[ws]
-	if player == nil || player.Role != state.CurrentTurn {
-		return
-	}
-
-	row := -1
-	for r := 5; r >= 0; r-- {
-		if state.Board[r][move.Column] == "" {
-			row = r
-			break
-		}
+// startGame sends everyone to the game page once all seats are taken. Only
+// the first time does it start the record and the clock: after that the
+// newcomer has taken over a seat in the game already being played.
+func startGame(room *GameRoom) {
+	for client := range room.Players {
+		sendStartGame(client, room)
 	}
-
-	if row == -1 {
+	if room.started {
+		room.resumeClock()
 		return
 	}
-
-	state.Board[row][move.Column] = player.Role
-
-	if state.CurrentTurn == "Red" {
-		state.CurrentTurn = "Yellow"
-	} else {
-		state.CurrentTurn = "Red"
-	}
-
-	room.GameState = state
-
-	moveMsg := Message{
-		Type: "connect4Move",
-		Payload: fmt.Sprintf(`{"row":%d,"column":%d,"player":"%s","username":"%s"}`,
-			row, move.Column, player.Role, player.Username),
-	}
-
-	for client := range room.Players {
-		client.WriteJSON(moveMsg)
-	}
-
-	checkConnect4GameEnd(room, row, move.Column)
+	room.started = true
+	room.startRecord()
+	room.resetClock()
 }
 
-func checkConnect4GameEnd(room *GameRoom, row, col int) {
-	state := room.GameState.(Connect4State)
-	player := state.Board[row][col]
-
-	directions := [][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
-
-	for _, dir := range directions {
-		count := 1
-
-		r, c := row+dir[0], col+dir[1]
-		for r >= 0 && r < 6 && c >= 0 && c < 7 && state.Board[r][c] == player {
-			count++
-			r, c = r+dir[0], c+dir[1]
-		}
-
-		r, c = row-dir[0], col-dir[1]
-		for r >= 0 && r < 6 && c >= 0 && c < 7 && state.Board[r][c] == player {
-			count++
-			r, c = r-dir[0], c-dir[1]
-		}
-
-		if count >= 4 {
-			state.GameActive = false
-			room.GameState = state
-
-			var winnerUsername string
-			for _, p := range room.Players {
-				if p.Role == player {
-					winnerUsername = p.Username
-					break
-				}
-			}
-
-			for client := range room.Players {
-				client.WriteJSON(Message{
-					Type:    "gameEnd",
-					Payload: fmt.Sprintf(`{"winner":"%s","winnerUsername":"%s"}`, player, winnerUsername),
-				})
-			}
-			return
-		}
-	}
-
-	full := true
-	for c := 0; c < 7; c++ {
-		if state.Board[0][c] == "" {
-			full = false
-			break
-		}
-	}
-
-	if full {
-		state.GameActive = false
-		room.GameState = state
-
-		for client := range room.Players {
-			client.WriteJSON(Message{
-				Type:    "gameEnd",
-				Payload: `{"winner":"draw"}`,
-			})
-		}
-	}
+func sendStartGame(ws *Client, room *GameRoom) {
+	player := room.Players[ws]
+	isHost := (ws == room.Host)
+	ws.Send(newMessage("startGame", StartGamePayload{
+		Code:     room.Code,
+		GameType: room.GameType,
+		IsHost:   isHost,
+		Username: player.Username,
+		Role:     player.Role,
+	}))
 }
 
-func handleNumberGuess(ws *websocket.Conn, msg Message) {
-	roomCode := findPlayerRoom(ws)
-	if roomCode == "" {
-		return
-	}
-
-	roomsMu.Lock()
-	room := rooms[roomCode]
-	roomsMu.Unlock()
-
+func handleGameMove(ws *Client, msg Message) {
+	room := findPlayerRoom(ws)
 	if room == nil {
+		sendMoveRejected(ws, msg.Type, rejectMove(ErrNotInRoom, "You are not in a room"))
 		return
 	}
 
 	room.mu.Lock()
 	defer room.mu.Unlock()
 
-	state, ok := room.GameState.(GuessNumberState)
-	if !ok || !state.GameActive {
-		return
-	}
-
-	var guess struct {
-		Number int `json:"number"`
-	}
-	json.Unmarshal([]byte(msg.Payload), &guess)
-
 	player := room.Players[ws]
 	if player == nil {
+		sendMoveRejected(ws, msg.Type, rejectMove(ErrNotInRoom, "You are not in this room"))
 		return
 	}
 
-	if state.Guesses[player.Role] == nil {
-		state.Guesses[player.Role] = []int{}
-	}
-	state.Guesses[player.Role] = append(state.Guesses[player.Role], guess.Number)
-
-	var result string
-	if guess.Number == state.TargetNumber {
-		result = "correct"
-		state.Winner = player.Role
-		state.GameActive = false
-	} else if guess.Number < state.TargetNumber {
-		result = "higher"
-	} else {
-		result = "lower"
-	}
-
-	if len(state.Guesses[player.Role]) >= state.MaxGuesses && state.GameActive {
-		state.GameActive = false
-		otherRole := "P1"
-		if player.Role == "P1" {
-			otherRole = "P2"
-		}
-		if state.Winner == "" {
-			state.Winner = otherRole
-		}
-	}
-
-	room.GameState = state
-
-	resultMsg := Message{
-		Type: "numberGuessResult",
-		Payload: fmt.Sprintf(`{"player":"%s","username":"%s","guess":%d,"result":"%s","target":%d,"gameActive":%t,"winner":"%s"}`,
-			player.Role, player.Username, guess.Number, result, state.TargetNumber, state.GameActive, state.Winner),
-	}
-
-	for client := range room.Players {
-		client.WriteJSON(resultMsg)
-	}
-}
-
-func handleLetterGuess(ws *websocket.Conn, msg Message) {
-	roomCode := findPlayerRoom(ws)
-	if roomCode == "" {
+	game := room.GameState
+	if !acceptsMove(game, msg.Type) {
+		sendMoveRejected(ws, msg.Type, rejectMove(ErrInvalidMove, fmt.Sprintf("%s is not a move in %s", msg.Type, room.GameType)))
 		return
 	}
 
-	roomsMu.Lock()
-	room := rooms[roomCode]
-	roomsMu.Unlock()
-
-	if room == nil {
+	if player.Role == RoleSpectator {
+		sendMoveRejected(ws, msg.Type, rejectMove(ErrSpectator, "Spectators cannot make moves"))
 		return
 	}
 
-	room.mu.Lock()
-	defer room.mu.Unlock()
-
-	state, ok := room.GameState.(WordGuessState)
-	if !ok || !state.GameActive {
+	if game.IsOver() {
+		sendMoveRejected(ws, msg.Type, rejectMove(ErrGameOver, "The game is over"))
 		return
 	}
 
-	var guess struct {
-		Letter string `json:"letter"`
-	}
-	json.Unmarshal([]byte(msg.Payload), &guess)
-
-	player := room.Players[ws]
-	if player == nil || player.Role != state.CurrentTurn {
+	if err := room.applyMove(player, msg); err != nil {
+		sendMoveRejected(ws, msg.Type, err)
 		return
 	}
 
-	letter := guess.Letter
-
-	for _, l := range state.GuessedLetters {
-		if l == letter {
-			return
-		}
-	}
-
-	state.GuessedLetters = append(state.GuessedLetters, letter)
-
-	found := false
-	for i, char := range state.Word {
-		if string(char) == letter {
-			state.GuessedWord[i] = letter
-			found = true
-		}
-	}
-
-	if !found {
-		state.WrongGuesses++
-	}
-
-	wordComplete := true
-	for _, char := range state.GuessedWord {
-		if char == "_" {
-			wordComplete = false
-			break
-		}
-	}
-
-	if wordComplete {
-		state.GameActive = false
-	} else if state.WrongGuesses >= state.MaxWrongGuesses {
-		state.GameActive = false
-	} else {
-
-		if state.CurrentTurn == "P1" {
-			state.CurrentTurn = "P2"
-		} else {
-			state.CurrentTurn = "P1"
-		}
-	}
-
-	room.GameState = state
-
-	guessedWordJSON, _ := json.Marshal(state.GuessedWord)
-	guessedLettersJSON, _ := json.Marshal(state.GuessedLetters)
-
-	resultMsg := Message{
-		Type: "letterGuessResult",
-		Payload: fmt.Sprintf(`{"letter":"%s","found":%t,"guessedWord":%s,"guessedLetters":%s,"wrongGuesses":%d,"gameActive":%t,"currentTurn":"%s","word":"%s"}`,
-			letter, found, guessedWordJSON, guessedLettersJSON, state.WrongGuesses, state.GameActive, state.CurrentTurn, state.Word),
-	}
-
-	for client := range room.Players {
-		client.WriteJSON(resultMsg)
-	}
+	room.playBotTurns()
 }
 
-func handleGameMove(ws *websocket.Conn, msg Message) {
-	roomCode := findPlayerRoom(ws)
-	if roomCode == "" {
-		return
-	}
-
-	roomsMu.Lock()
-	room := rooms[roomCode]
-	roomsMu.Unlock()
-
+func handleGameRestart(ws *Client, msg Message) {
+	room := findPlayerRoom(ws)
 	if room == nil {
+		sendError(ws, ErrNotInRoom, "You are not in a room")
 		return
 	}
 
-	if room.GameType == GameTypeTicTacToe {
-		handleTicTacToeMove(room, ws, msg)
-	}
-}
-
-func handleTicTacToeMove(room *GameRoom, ws *websocket.Conn, msg Message) {
 	room.mu.Lock()
 	defer room.mu.Unlock()
 
-	state, ok := room.GameState.(TicTacToeState)
-	if !ok || !state.GameActive {
-		return
-	}
-
-	var move struct {
-		Index  int    `json:"index"`
-		Player string `json:"player"`
-	}
-	json.Unmarshal([]byte(msg.Payload), &move)
-
-	player := room.Players[ws]
-	if player == nil || player.Role != state.CurrentTurn {
+	if ws != room.Host {
+		sendError(ws, ErrNotHost, "Only the host can restart the game")
 		return
 	}
 
-	if move.Index < 0 || move.Index >= 9 || state.Board[move.Index] != "" {
+	// Until startGame has run there is no game to restart, and a clock
+	// would start ticking for a player with no opponent.
+	if !room.started || room.nextFreeRole() != "" {
+		sendError(ws, ErrGameNotStarted, "Wait for every seat to be filled before restarting")
 		return
 	}
 
-	state.Board[move.Index] = player.Role
-
-	if state.CurrentTurn == "X" {
-		state.CurrentTurn = "O"
-	} else {
-		state.CurrentTurn = "X"
-	}
-
-	room.GameState = state
-
-	moveMsg := Message{
-		Type:    "move",
-		Payload: fmt.Sprintf(`{"index":%d,"player":"%s","username":"%s"}`, move.Index, player.Role, player.Username),
-	}
-
-	for client := range room.Players {
-		client.WriteJSON(moveMsg)
-	}
+	room.GameState.Restart()
 
-	checkTicTacToeGameEnd(room)
+	room.sendAll(newMessage("restart", nil))
+	room.startRecord()
+	room.resetClock()
+	room.playBotTurns()
 }
 
-func checkTicTacToeGameEnd(room *GameRoom) {
-	state := room.GameState.(TicTacToeState)
-
-	winningCombos := [][3]int{
-		{0, 1, 2}, {3, 4, 5}, {6, 7, 8},
-		{0, 3, 6}, {1, 4, 7}, {2, 5, 8},
-		{0, 4, 8}, {2, 4, 6},
-	}
-
-	for _, combo := range winningCombos {
-		a, b, c := combo[0], combo[1], combo[2]
-		if state.Board[a] != "" && state.Board[a] == state.Board[b] && state.Board[a] == state.Board[c] {
-			state.GameActive = false
-			room.GameState = state
-
-			var winnerUsername string
-			for _, player := range room.Players {
-				if player.Role == state.Board[a] {
-					winnerUsername = player.Username
-					break
-				}
-			}
-
-			for client := range room.Players {
-				client.WriteJSON(Message{
-					Type:    "gameEnd",
-					Payload: fmt.Sprintf(`{"winner":"%s","winnerUsername":"%s"}`, state.Board[a], winnerUsername),
-				})
-			}
-			return
-		}
-	}
-
-	isDraw := true
-	for _, cell := range state.Board {
-		if cell == "" {
-			isDraw = false
-			break
-		}
-	}
-
-	if isDraw {
-		state.GameActive = false
-		room.GameState = state
-
-		for client := range room.Players {
-			client.WriteJSON(Message{
-				Type:    "gameEnd",
-				Payload: `{"winner":"draw"}`,
-			})
-		}
-	}
+// findPlayerRoom returns the room ws belongs to, or nil.
+func findPlayerRoom(ws *Client) *GameRoom {
+	playerRoomsMu.RLock()
+	defer playerRoomsMu.RUnlock()
+	return playerRooms[ws]
 }
 
-func handleGameRestart(ws *websocket.Conn, msg Message) {
-	roomCode := findPlayerRoom(ws)
-	if roomCode == "" {
-		return
+// setPlayerRoom records that ws has joined room. The caller holds room.mu and
+// has already added ws to room.Players.
+func setPlayerRoom(ws *Client, room *GameRoom) {
+	if player := room.Players[ws]; player != nil {
+		ws.setLogRoom(room.Code, player.Username)
 	}
 
-	roomsMu.Lock()
-	room := rooms[roomCode]
-	roomsMu.Unlock()
-
-	if room == nil {
-		return
-	}
+	playerRoomsMu.Lock()
+	defer playerRoomsMu.Unlock()
+	playerRooms[ws] = room
+}
 
-	room.mu.Lock()
-	defer room.mu.Unlock()
+func clearPlayerRoom(ws *Client) {
+	ws.setLogRoom("", "")
 
-	if ws != room.Host {
-		ws.WriteJSON(Message{
-			Type:    "error",
-			Payload: "Only the host can restart the game",
-		})
-		return
-	}
+	playerRoomsMu.Lock()
+	defer playerRoomsMu.Unlock()
+	delete(playerRooms, ws)
+}
 
-	switch room.GameType {
-	case GameTypeTicTacToe:
-		room.GameState = TicTacToeState{
-			Board:       [9]string{},
-			CurrentTurn: "X",
-			GameActive:  true,
-		}
-	case GameTypeRPS:
-		state := room.GameState.(RPSState)
-		state.Choices = make(map[string]string)
-		state.Round++
-		room.GameState = state
-	case GameTypeConnect4:
-		room.GameState = Connect4State{
-			Board:       [6][7]string{},
-			CurrentTurn: "Red",
-			GameActive:  true,
-		}
-	case GameTypeGuessNumber:
-		room.GameState = GuessNumberState{
-			TargetNumber: rand.Intn(100) + 1,
-			Guesses:      make(map[string][]int),
-			MaxGuesses:   10,
-			GameActive:   true,
-		}
-	case GameTypeWordGuess:
-		word := wordList[rand.Intn(len(wordList))]
-		guessedWord := make([]string, len(word))
-		for i := range guessedWord {
-			guessedWord[i] = "_"
-		}
-		room.GameState = WordGuessState{
-			Word:            word,
-			GuessedWord:     guessedWord,
-			GuessedLetters:  []string{},
-			WrongGuesses:    0,
-			MaxWrongGuesses: 6,
-			GameActive:      true,
-			CurrentTurn:     "P1",
-		}
-	case GameTypeDots:
-		room.GameState = DotsState{
-			Grid:        [4][4]bool{},
-			Lines:       []Line{},
-			Boxes:       [3][3]string{},
-			CurrentTurn: "P1",
-			GameActive:  true,
-			Scores:      map[string]int{"P1": 0, "P2": 0},
-		}
+// deleteRoom removes room and everyone still in it from the lookup tables.
+// The caller holds roomsMu and room.mu.
+func deleteRoom(room *GameRoom) {
+	room.stopClock()
+	room.closeRecord("abandoned")
+	delete(rooms, room.Code)
+	if room.Public {
+		notifyRoomList()
 	}
-
 	for client := range room.Players {
-		client.WriteJSON(Message{
-			Type:    "restart",
-			Payload: "",
-		})
+		clearPlayerRoom(client)
 	}
 }
 
-func handleRPSChoice(ws *websocket.Conn, msg Message) {
-	roomCode := findPlayerRoom(ws)
-	if roomCode == "" {
-		return
-	}
-
+// handleDisconnect runs once ws has been closed. The room is looked up under
+// roomsMu so that matchmaking, which checks for closed clients under the same
+// lock, has either seated ws already or will not seat it at all.
+func handleDisconnect(ws *Client) {
 	roomsMu.Lock()
-	room := rooms[roomCode]
+	room := findPlayerRoom(ws)
 	roomsMu.Unlock()
-
 	if room == nil {
 		return
 	}
@@ -1063,138 +800,69 @@ func handleRPSChoice(ws *websocket.Conn, msg Message) {
 	room.mu.Lock()
 	defer room.mu.Unlock()
 
-	state, ok := room.GameState.(RPSState)
-	if !ok {
-		return
-	}
-
-	var choice struct {
-		Choice string `json:"choice"`
-	}
-	json.Unmarshal([]byte(msg.Payload), &choice)
-
-	player := room.Players[ws]
-	if player == nil {
+	player, exists := room.Players[ws]
+	if !exists {
 		return
 	}
 
-	state.Choices[player.Role] = choice.Choice
-	room.GameState = state
-
-	if len(state.Choices) == 2 {
-		p1Choice := state.Choices["P1"]
-		p2Choice := state.Choices["P2"]
-
-		var result string
-		if p1Choice == p2Choice {
-			result = "draw"
-		} else if (p1Choice == "rock" && p2Choice == "scissors") ||
-			(p1Choice == "paper" && p2Choice == "rock") ||
-			(p1Choice == "scissors" && p2Choice == "paper") {
-			result = "P1"
-		} else {
-			result = "P2"
-		}
-
-		resultMsg := Message{
-			Type: "rpsResult",
-			Payload: fmt.Sprintf(`{"p1":"%s","p2":"%s","winner":"%s","round":%d}`,
-				p1Choice, p2Choice, result, state.Round),
-		}
+	isHost := (ws == room.Host)
+	player.Connected = false
 
-		for client := range room.Players {
-			client.WriteJSON(resultMsg)
+	// Spectators come and go without interrupting the game.
+	for client := range room.Players {
+		if client != ws && player.Role != RoleSpectator {
+			client.Send(newMessage("playerLeft", PlayerLeftPayload{
+				Player:   player.Role,
+				Username: player.Username,
+				IsHost:   isHost,
+			}))
 		}
-
-		state.Choices = make(map[string]string)
-		state.Round++
-		room.GameState = state
 	}
-}
-
-func handleDotsMove(ws *websocket.Conn, msg Message) {
-}
-
-func findPlayerRoom(ws *websocket.Conn) string {
-	roomsMu.Lock()
-	defer roomsMu.Unlock()
 
-	for code, room := range rooms {
-		room.mu.Lock()
-		_, exists := room.Players[ws]
-		room.mu.Unlock()
-		if exists {
-			return code
-		}
-	}
-	return ""
+	go room.expireSeat(ws, player, config.ReconnectGrace)
 }
 
-func handleDisconnect(ws *websocket.Conn) {
-	roomCode := findPlayerRoom(ws)
-	if roomCode == "" {
-		return
-	}
+// expireSeat waits for grace, then gives up on a disconnected player who has
+// not reclaimed their seat: the seat is freed, and the room handed to someone
+// else or closed when the player was its host.
+func (room *GameRoom) expireSeat(ws *Client, player *Player, grace time.Duration) {
+	time.Sleep(grace)
 
 	roomsMu.Lock()
 	defer roomsMu.Unlock()
 
-	room := rooms[roomCode]
-	if room == nil {
+	if rooms[room.Code] != room {
 		return
 	}
 
 	room.mu.Lock()
 	defer room.mu.Unlock()
 
-	player, exists := room.Players[ws]
-	if !exists {
-		return
-	}
-
-	isHost := (ws == room.Host)
-
-	for client := range room.Players {
-		if client != ws {
-			client.WriteJSON(Message{
-				Type:    "playerLeft",
-				Payload: fmt.Sprintf(`{"player":"%s","username":"%s","isHost":%t}`, player.Role, player.Username, isHost),
-			})
-		}
-	}
-
-	go func() {
-		time.Sleep(10 * time.Second)
-
-		roomsMu.Lock()
-		defer roomsMu.Unlock()
+	currentPlayer, stillExists := room.Players[ws]
+	if stillExists && currentPlayer == player {
+		delete(room.Players, ws)
+		clearPlayerRoom(ws)
 
-		room, exists := rooms[roomCode]
-		if !exists {
+		// The host may have handed the room over while away.
+		if ws == room.Host && room.promoteHost(player.Username) {
 			return
 		}
 
-		room.mu.Lock()
-		defer room.mu.Unlock()
-
-		currentPlayer, stillExists := room.Players[ws]
-		if stillExists && currentPlayer == player {
-			delete(room.Players, ws)
-
-			if isHost {
-				delete(rooms, roomCode)
+		if ws == room.Host {
+			deleteRoom(room)
 
-				for client := range room.Players {
-					client.WriteJSON(Message{
-						Type:    "hostLeft",
-						Payload: fmt.Sprintf("Host %s has left the game", player.Username),
-					})
-				}
-			} else if len(room.Players) == 0 {
-				delete(rooms, roomCode)
+			for client := range room.Players {
+				client.Send(newMessage("hostLeft", HostLeftPayload{
+					Username: player.Username,
+					Message:  fmt.Sprintf("Host %s has left the game", player.Username),
+				}))
 			}
+		} else if len(room.Players) == 0 {
+			deleteRoom(room)
+		} else {
+			updateLobby(room)
 		}
-	}()
+	}
 }
 
 func handleMessages() {
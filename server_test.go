@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// seedRooms registers n rock paper scissors rooms, each with two players
+// behind detached clients, and returns the clients seat by seat: P1 of the
+// first room, P2 of the first room, P1 of the second, and so on.
+func seedRooms(b *testing.B, n int) []*Client {
+	b.Helper()
+
+	roomsMu.Lock()
+	playerRoomsMu.Lock()
+	seats := make([]*Client, 0, 2*n)
+	for i := 0; i < n; i++ {
+		game, _ := newGame(GameTypeRPS)
+		room := &GameRoom{
+			Code:      fmt.Sprintf("B%05d", i),
+			GameType:  GameTypeRPS,
+			Players:   make(map[*Client]*Player),
+			GameState: game,
+			CreatedAt: time.Now(),
+		}
+		for _, role := range game.Roles() {
+			client := newDetachedClient()
+			room.Players[client] = &Player{Conn: client, Username: role, Role: role, Connected: true}
+			playerRooms[client] = room
+			seats = append(seats, client)
+		}
+		rooms[room.Code] = room
+	}
+	playerRoomsMu.Unlock()
+	roomsMu.Unlock()
+
+	b.Cleanup(func() {
+		roomsMu.Lock()
+		rooms = make(map[string]*GameRoom)
+		roomsMu.Unlock()
+
+		playerRoomsMu.Lock()
+		playerRooms = make(map[*Client]*GameRoom)
+		playerRoomsMu.Unlock()
+	})
+	return seats
+}
+
+// BenchmarkHandleGameMove measures moves routed through handleMessage while
+// many rooms are open. Finding a player's room goes through playerRooms, so
+// the time per move should not grow with the number of rooms.
+func BenchmarkHandleGameMove(b *testing.B) {
+	for _, n := range []int{10, 1000, 10000} {
+		b.Run(fmt.Sprintf("rooms=%d", n), func(b *testing.B) {
+			seats := seedRooms(b, n)
+			move := newMessage("rpsChoice", map[string]string{"choice": "rock"})
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				handleMessage(seats[i%len(seats)], move)
+			}
+			b.StopTimer()
+
+			// Every move counts towards a round, unless one was rejected.
+			played := 0
+			for _, room := range rooms {
+				state := room.GameState.(*RPSState)
+				played += 2*(state.Round-1) + len(state.Choices)
+			}
+			if played != b.N {
+				b.Fatalf("%d of %d moves were played", played, b.N)
+			}
+		})
+	}
+}
+
+// registerTestRoom adds room to the lookup tables for the length of the test.
+func registerTestRoom(t testing.TB, room *GameRoom) {
+	t.Helper()
+
+	roomsMu.Lock()
+	rooms[room.Code] = room
+	roomsMu.Unlock()
+	for client := range room.Players {
+		setPlayerRoom(client, room)
+	}
+
+	t.Cleanup(func() {
+		roomsMu.Lock()
+		delete(rooms, room.Code)
+		roomsMu.Unlock()
+
+		room.mu.Lock()
+		defer room.mu.Unlock()
+		room.stopClock()
+		for client := range room.Players {
+			clearPlayerRoom(client)
+		}
+	})
+}
+
+func TestJoinFreedSeatKeepsGameInProgress(t *testing.T) {
+	room := newTestRoom(t, GameTypeTicTacToe)
+	room.Clock = newTurnClock(TimeControl{Mode: ClockTotal, InitialSeconds: 60})
+	registerTestRoom(t, room)
+
+	room.mu.Lock()
+	startGame(room)
+	record := room.Record
+	if err := room.applyMove(room.playerForRole("X"), newMessage("move", map[string]int{"index": 4})); err != nil {
+		t.Fatal(err)
+	}
+	room.Clock.Remaining["X"] = 42 * time.Second
+
+	// O's seat expires mid-game.
+	o := room.playerForRole("O")
+	delete(room.Players, o.Conn)
+	clearPlayerRoom(o.Conn)
+	room.mu.Unlock()
+
+	newcomer := newTestClient()
+	handleJoinRoom(newcomer, newMessage("join", map[string]string{"code": room.Code, "username": "replacement"}))
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	if player := room.Players[newcomer]; player == nil || player.Role != "O" {
+		t.Fatalf("newcomer was not seated as O: %+v", player)
+	}
+	if room.Record != record {
+		t.Error("joining replaced the match record")
+	}
+	if n := len(record.Events); n != 1 {
+		t.Errorf("record has %d events, want 1", n)
+	}
+	if left := room.Clock.Remaining["X"]; left != 42*time.Second {
+		t.Errorf("X has %v left, want 42s", left)
+	}
+	if room.Clock.Turn != "O" {
+		t.Errorf("clock is timing %q, want O", room.Clock.Turn)
+	}
+}
+
+func TestRestartWaitsForEverySeat(t *testing.T) {
+	room := newTestRoom(t, GameTypeTicTacToe)
+	room.Clock = newTurnClock(TimeControl{Mode: ClockPerMove, MoveSeconds: 30, OnTimeout: TimeoutLose})
+	o := room.playerForRole("O")
+	delete(room.Players, o.Conn)
+	registerTestRoom(t, room)
+
+	host := room.Host
+	handleGameRestart(host, newMessage("restart", nil))
+
+	var code string
+	for _, msg := range sentMessages(host) {
+		if msg.Type == "error" {
+			var payload ErrorPayload
+			msg.decodePayload(&payload)
+			code = payload.Code
+		}
+	}
+	if code != ErrGameNotStarted {
+		t.Errorf("restart with an empty seat answered %q, want %s", code, ErrGameNotStarted)
+	}
+
+	room.mu.Lock()
+	if room.Record != nil || room.Clock.Turn != "" {
+		t.Errorf("restart with an empty seat started the record or the clock for %q", room.Clock.Turn)
+	}
+	room.Players[o.Conn] = o
+	setPlayerRoom(o.Conn, room)
+	startGame(room)
+	room.mu.Unlock()
+
+	handleGameRestart(host, newMessage("restart", nil))
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if room.Record == nil || room.Clock.Turn != "X" {
+		t.Errorf("restart of a game in progress did not restart the record and the clock")
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// shutdownTimeout bounds how long a shutdown waits for the HTTP server to stop
+// and for queued messages to reach clients.
+const shutdownTimeout = 5 * time.Second
+
+// RoomSnapshot is everything needed to bring a room back after a restart.
+type RoomSnapshot struct {
+	Code      string           `json:"code"`
+	GameType  string           `json:"gameType"`
+	GameState json.RawMessage  `json:"gameState"`
+	Players   []PlayerSnapshot `json:"players"`
+	Public    bool             `json:"public"`
+	Password  *RoomPassword    `json:"password,omitempty"`
+	Bans      RoomBans         `json:"bans"`
+	Chat      []ChatMessage    `json:"chat"`
+	Clock     *ClockSnapshot   `json:"clock,omitempty"`
+	Record    *MatchRecord     `json:"record,omitempty"`
+	Started   bool             `json:"started"`
+	CreatorIP string           `json:"creatorIp"`
+	CreatedAt time.Time        `json:"createdAt"`
+}
+
+type PlayerSnapshot struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Token    string `json:"token"`
+	BotLevel string `json:"botLevel,omitempty"`
+	Host     bool   `json:"host"`
+}
+
+type ClockSnapshot struct {
+	Control   TimeControl              `json:"control"`
+	Remaining map[string]time.Duration `json:"remaining"`
+	Running   bool                     `json:"running"`
+}
+
+type ServerShutdownPayload struct {
+	Message string `json:"message"`
+}
+
+// snapshot captures the room as it stands. The caller holds room.mu.
+func (room *GameRoom) snapshot() (RoomSnapshot, error) {
+	state, err := json.Marshal(room.GameState)
+	if err != nil {
+		return RoomSnapshot{}, err
+	}
+
+	snap := RoomSnapshot{
+		Code:      room.Code,
+		GameType:  room.GameType,
+		GameState: state,
+		Public:    room.Public,
+		Password:  room.Password,
+		Bans:      room.Bans,
+		Chat:      room.Chat,
+		Record:    room.Record,
+		Started:   room.started,
+		CreatorIP: room.CreatorIP,
+		CreatedAt: room.CreatedAt,
+	}
+
+	for client, player := range room.Players {
+		// Spectators simply join again.
+		if player.Role == RoleSpectator {
+			continue
+		}
+		snap.Players = append(snap.Players, PlayerSnapshot{
+			Username: player.Username,
+			Role:     player.Role,
+			Token:    player.Token,
+			BotLevel: player.BotLevel,
+			Host:     client == room.Host,
+		})
+	}
+
+	if clock := room.Clock; clock != nil {
+		snap.Clock = &ClockSnapshot{
+			Control:   clock.Control,
+			Remaining: make(map[string]time.Duration),
+			Running:   clock.Turn != "" || room.clockPaused,
+		}
+		for role, left := range room.clockPayload().RemainingMs {
+			snap.Clock.Remaining[role] = time.Duration(left) * time.Millisecond
+		}
+	}
+
+	return snap, nil
+}
+
+// saveRooms writes a snapshot of every room to path. The caller holds roomsMu
+// and every room's lock, so nothing can change until the process exits.
+func saveRooms(path string) error {
+	snapshots := make([]RoomSnapshot, 0, len(rooms))
+	for _, room := range rooms {
+		snap, err := room.snapshot()
+		if err != nil {
+			slog.Error("Error saving room", "room", room.Code, "err", err)
+			continue
+		}
+		snapshots = append(snapshots, snap)
+	}
+
+	data, err := json.MarshalIndent(snapshots, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// The snapshot holds session tokens, so keep it private.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	slog.Info("Saved rooms", "rooms", len(snapshots), "path", path)
+	return nil
+}
+
+// restoreRooms brings back the rooms saved by the last shutdown. Players get
+// config.RestoreGrace to rejoin with their session token before their seat is
+// given up. The snapshot is removed once parsed so that a later crash does
+// not bring the same rooms back twice. One that cannot be parsed is left on
+// disk for the operator to repair.
+func restoreRooms(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var snapshots []RoomSnapshot
+	if err := json.Unmarshal(data, &snapshots); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+
+	for _, snap := range snapshots {
+		room, err := restoreRoom(snap)
+		if err != nil {
+			slog.Error("Error restoring room", "room", snap.Code, "err", err)
+			continue
+		}
+		rooms[room.Code] = room
+		if room.Public {
+			notifyRoomList()
+		}
+		slog.Info("Restored room", "room", room.Code, "game", room.GameType, "players", len(room.Players))
+	}
+	return nil
+}
+
+// restoreRoom rebuilds a room from its snapshot. Every human seat is held by
+// a detached client, just as if its player had lost their connection. The
+// caller holds roomsMu.
+func restoreRoom(snap RoomSnapshot) (*GameRoom, error) {
+	if rooms[snap.Code] != nil {
+		return nil, fmt.Errorf("code already in use")
+	}
+
+	game, ok := newGame(snap.GameType)
+	if !ok {
+		return nil, fmt.Errorf("unknown game type %s", snap.GameType)
+	}
+	if err := json.Unmarshal(snap.GameState, game); err != nil {
+		return nil, err
+	}
+
+	room := &GameRoom{
+		Code:      snap.Code,
+		GameType:  snap.GameType,
+		Players:   make(map[*Client]*Player),
+		GameState: game,
+		Record:    snap.Record,
+		Public:    snap.Public,
+		Password:  snap.Password,
+		Bans:      snap.Bans,
+		Chat:      snap.Chat,
+		CreatorIP: snap.CreatorIP,
+		CreatedAt: snap.CreatedAt,
+		started:   snap.Started,
+	}
+
+	if snap.Clock != nil {
+		room.Clock = newTurnClock(snap.Clock.Control)
+		for role, left := range snap.Clock.Remaining {
+			room.Clock.Remaining[role] = left
+		}
+		room.clockPaused = snap.Clock.Running
+	}
+
+	for _, saved := range snap.Players {
+		player := &Player{
+			Username: saved.Username,
+			Role:     saved.Role,
+			Token:    saved.Token,
+			BotLevel: saved.BotLevel,
+		}
+
+		if saved.BotLevel != "" {
+			player.Conn = newBotClient()
+			player.Connected = true
+			room.Players[player.Conn] = player
+		} else {
+			player.Conn = newDetachedClient()
+			room.Players[player.Conn] = player
+			setPlayerRoom(player.Conn, room)
+			go room.expireSeat(player.Conn, player, config.RestoreGrace)
+		}
+
+		if saved.Host {
+			room.Host = player.Conn
+		}
+	}
+
+	// A room whose host was a spectator is handed to the first seated human.
+	if room.Host == nil {
+		for client, player := range room.Players {
+			if player.BotLevel == "" {
+				room.Host = client
+				break
+			}
+		}
+	}
+	if room.Host == nil {
+		return nil, fmt.Errorf("no players left")
+	}
+
+	return room, nil
+}
+
+// resumeClock restarts a restored room's clock once every seated player is
+// back, so nobody loses time while the server restarts. The caller holds
+// room.mu.
+func (room *GameRoom) resumeClock() {
+	if !room.clockPaused {
+		return
+	}
+	for _, player := range room.Players {
+		if player.Role != RoleSpectator && !player.Connected {
+			return
+		}
+	}
+
+	room.clockPaused = false
+	room.startTurnTimer()
+}
+
+// shutdown stops the server without losing any rooms: it stops accepting
+// connections, saves every room to path, tells every client the server is
+// going away and waits for those messages to go out.
+func shutdown(srv *http.Server, path string) {
+	serverReady.Store(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("Error stopping HTTP server", "err", err)
+	}
+
+	// The locks are never released: the process exits with the rooms
+	// exactly as they were saved.
+	roomsMu.Lock()
+	for _, room := range rooms {
+		room.mu.Lock()
+	}
+	if err := saveRooms(path); err != nil {
+		slog.Error("Error saving rooms", "err", err)
+	}
+	if matchStore != nil {
+		matchStore.Flush()
+	}
+	if ratingStore != nil {
+		ratingStore.Flush()
+	}
+
+	deadline := time.After(shutdownTimeout)
+	list := connectedClients()
+	for _, client := range list {
+		client.Send(newMessage("serverShutdown", ServerShutdownPayload{
+			Message: "The server is restarting. Your game will resume when it is back.",
+		}))
+		client.Close()
+	}
+	for _, client := range list {
+		select {
+		case <-client.stopped:
+		case <-deadline:
+			slog.Warn("Gave up waiting for clients to disconnect")
+			return
+		}
+	}
+	slog.Info("Disconnected clients", "clients", len(list))
+}
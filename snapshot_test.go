@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRestoreRoomsKeepsUnreadableSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rooms.json")
+	if err := os.WriteFile(path, []byte(`[{"code": "ABC`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restoreRooms(path); err == nil {
+		t.Fatal("restoring a truncated snapshot succeeded")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("the snapshot is gone after failing to parse: %v", err)
+	}
+}
+
+func TestRestoreRoomsRemovesSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rooms.json")
+	if err := os.WriteFile(path, []byte(`[]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restoreRooms(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the snapshot was not removed once restored: %v", err)
+	}
+}
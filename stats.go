@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GameStats summarises one player's finished games of one type.
+type GameStats struct {
+	GameType         string  `json:"gameType"`
+	Games            int     `json:"games"`
+	Wins             int     `json:"wins"`
+	Losses           int     `json:"losses"`
+	Draws            int     `json:"draws"`
+	CurrentStreak    int     `json:"currentStreak"` // positive for wins, negative for losses
+	LongestWinStreak int     `json:"longestWinStreak"`
+	AverageMoves     float64 `json:"averageMoves"`
+	AverageSeconds   float64 `json:"averageSeconds"`
+	Rating           int     `json:"rating,omitempty"`
+
+	totalMoves    int
+	totalDuration time.Duration
+}
+
+type PlayerStatsPayload struct {
+	Username string       `json:"username"`
+	Games    []*GameStats `json:"games"`
+}
+
+type LeaderboardEntry struct {
+	Rank     int    `json:"rank"`
+	Username string `json:"username"`
+	*GameStats
+}
+
+func (stats *GameStats) add(summary MatchSummary, role string) {
+	stats.Games++
+	stats.totalMoves += summary.Moves
+	stats.totalDuration += summary.EndedAt.Sub(summary.StartedAt)
+
+	switch summary.Result.Winner {
+	case "draw":
+		stats.Draws++
+		stats.CurrentStreak = 0
+	case role:
+		stats.Wins++
+		if stats.CurrentStreak < 0 {
+			stats.CurrentStreak = 0
+		}
+		stats.CurrentStreak++
+		if stats.CurrentStreak > stats.LongestWinStreak {
+			stats.LongestWinStreak = stats.CurrentStreak
+		}
+	default:
+		stats.Losses++
+		if stats.CurrentStreak > 0 {
+			stats.CurrentStreak = 0
+		}
+		stats.CurrentStreak--
+	}
+
+	stats.AverageMoves = float64(stats.totalMoves) / float64(stats.Games)
+	stats.AverageSeconds = stats.totalDuration.Seconds() / float64(stats.Games)
+}
+
+// addStats counts a stored match towards its players' statistics. Matches
+// must be added oldest first for streaks to add up. Abandoned games and bots
+// are left out. The caller holds store.mu.
+func (store *MatchStore) addStats(summary MatchSummary) {
+	if summary.Result == nil || summary.Result.Winner == "" {
+		return
+	}
+
+	byPlayer := store.stats[summary.GameType]
+	if byPlayer == nil {
+		byPlayer = make(map[string]*GameStats)
+		store.stats[summary.GameType] = byPlayer
+	}
+	for _, player := range summary.Players {
+		if player.Bot {
+			continue
+		}
+		gameStats := byPlayer[player.Username]
+		if gameStats == nil {
+			gameStats = &GameStats{GameType: summary.GameType}
+			byPlayer[player.Username] = gameStats
+		}
+		gameStats.add(summary, player.Role)
+	}
+}
+
+// gameStats returns a copy of the statistics of everyone who finished a game
+// of gameType, by username.
+func (store *MatchStore) gameStats(gameType string) map[string]*GameStats {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	stats := make(map[string]*GameStats, len(store.stats[gameType]))
+	for username, gameStats := range store.stats[gameType] {
+		copied := *gameStats
+		copied.Rating = currentRating(gameType, username)
+		stats[username] = &copied
+	}
+	return stats
+}
+
+// playerStats returns a copy of username's statistics for every game type
+// they finished a game of.
+func (store *MatchStore) playerStats(username string) []*GameStats {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var games []*GameStats
+	for gameType, byPlayer := range store.stats {
+		if gameStats := byPlayer[username]; gameStats != nil {
+			copied := *gameStats
+			copied.Rating = currentRating(gameType, username)
+			games = append(games, &copied)
+		}
+	}
+	return games
+}
+
+// currentRating returns username's rating at gameType, or 0 for games that
+// are not rated.
+func currentRating(gameType, username string) int {
+	if !ratedGames[gameType] || ratingStore == nil {
+		return 0
+	}
+	return int(math.Round(ratingStore.Get(gameType, username).Rating))
+}
+
+// handleLeaderboard serves GET /api/leaderboard?game=&limit=. Rated games are
+// ranked by rating, the others by wins.
+func handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Use GET")
+		return
+	}
+
+	gameType := r.URL.Query().Get("game")
+	if _, ok := gameRegistry[gameType]; !ok {
+		writeJSONError(w, http.StatusBadRequest, ErrUnknownGameType, fmt.Sprintf("Unknown game type %q", gameType))
+		return
+	}
+
+	limit := 20
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 500 {
+			writeJSONError(w, http.StatusBadRequest, "BAD_REQUEST", "limit must be between 1 and 500")
+			return
+		}
+		limit = n
+	}
+
+	entries := make([]LeaderboardEntry, 0)
+	for username, gameStats := range matchStore.gameStats(gameType) {
+		entries = append(entries, LeaderboardEntry{Username: username, GameStats: gameStats})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Rating != b.Rating {
+			return a.Rating > b.Rating
+		}
+		if a.Wins != b.Wins {
+			return a.Wins > b.Wins
+		}
+		if a.Losses != b.Losses {
+			return a.Losses < b.Losses
+		}
+		return a.Username < b.Username
+	})
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// handlePlayerStats serves GET /api/players/{username}.
+func handlePlayerStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Use GET")
+		return
+	}
+
+	username, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/api/players/"))
+	if err != nil || username == "" {
+		writeJSONError(w, http.StatusBadRequest, "BAD_REQUEST", "Missing username")
+		return
+	}
+
+	games := matchStore.playerStats(username)
+	if len(games) == 0 {
+		writeJSONError(w, http.StatusNotFound, "PLAYER_NOT_FOUND", fmt.Sprintf("No finished games for %s", username))
+		return
+	}
+
+	payload := PlayerStatsPayload{Username: username, Games: games}
+	sort.Slice(payload.Games, func(i, j int) bool {
+		return payload.Games[i].GameType < payload.Games[j].GameType
+	})
+
+	writeJSON(w, http.StatusOK, payload)
+}
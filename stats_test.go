@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMatchStoreStats(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openMatchStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(-time.Hour)
+	results := []struct {
+		opponent MatchPlayer
+		winner   string
+	}{
+		{MatchPlayer{Username: "bob", Role: "O"}, "X"},
+		{MatchPlayer{Username: "bob", Role: "O"}, "X"},
+		{MatchPlayer{Username: "carol", Role: "O"}, "O"},
+		{MatchPlayer{Username: "bob", Role: "O"}, "draw"},
+		{MatchPlayer{Username: "bob", Role: "O"}, ""}, // abandoned
+		{MatchPlayer{Username: "Computer (hard)", Role: "O", Bot: true}, "X"},
+	}
+	for i, result := range results {
+		record := &MatchRecord{
+			ID:        fmt.Sprintf("%d-GAME%d", i+1, i),
+			GameType:  GameTypeTicTacToe,
+			Players:   []MatchPlayer{{Username: "alice", Role: "X"}, result.opponent},
+			Events:    make([]MatchEvent, 5),
+			Result:    &MatchResult{Winner: result.winner},
+			StartedAt: start.Add(time.Duration(i) * time.Minute),
+			EndedAt:   start.Add(time.Duration(i)*time.Minute + 30*time.Second),
+		}
+		if err := store.Save(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := GameStats{
+		GameType:         GameTypeTicTacToe,
+		Games:            5,
+		Wins:             3,
+		Losses:           1,
+		Draws:            1,
+		CurrentStreak:    1,
+		LongestWinStreak: 2,
+		AverageMoves:     5,
+		AverageSeconds:   30,
+	}
+
+	reopened, err := openMatchStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]*MatchStore{"saved": store, "reopened": reopened} {
+		games := s.playerStats("alice")
+		if len(games) != 1 {
+			t.Fatalf("%s: alice has stats for %d game types, want 1", name, len(games))
+		}
+		got := *games[0]
+		got.totalMoves, got.totalDuration = 0, 0
+		if got != want {
+			t.Errorf("%s: alice's stats are %+v, want %+v", name, got, want)
+		}
+
+		leaderboard := s.gameStats(GameTypeTicTacToe)
+		if len(leaderboard) != 3 {
+			t.Errorf("%s: %d players on the leaderboard, want alice, bob and carol", name, len(leaderboard))
+		}
+		if bob := leaderboard["bob"]; bob == nil || bob.Games != 3 || bob.Losses != 2 || bob.Draws != 1 {
+			t.Errorf("%s: bob's stats are %+v, want 3 games, 2 losses and a draw", name, bob)
+		}
+	}
+}
+
+func TestMatchStoreSavesInOrder(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openMatchStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rounds of rock paper scissors end in quick succession: three wins,
+	// a loss, then two wins.
+	winners := []string{"P1", "P1", "P1", "P2", "P1", "P1"}
+	for i, winner := range winners {
+		store.enqueue(&MatchRecord{
+			ID:        fmt.Sprintf("%d-ROUND%d", i+1, i),
+			GameType:  GameTypeRPS,
+			Players:   []MatchPlayer{{Username: "alice", Role: "P1"}, {Username: "bob", Role: "P2"}},
+			Events:    make([]MatchEvent, 2),
+			Result:    &MatchResult{Winner: winner},
+			StartedAt: time.Now(),
+		})
+	}
+	store.Flush()
+
+	reopened, err := openMatchStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]*MatchStore{"saved": store, "reopened": reopened} {
+		alice := s.gameStats(GameTypeRPS)["alice"]
+		if alice == nil || alice.Games != 6 || alice.CurrentStreak != 2 || alice.LongestWinStreak != 3 {
+			t.Errorf("%s: alice's stats are %+v, want 6 games, a streak of 2 and a longest of 3", name, alice)
+		}
+
+		matches := s.List("", "", 10)
+		for i, summary := range matches {
+			if want := fmt.Sprintf("%d-ROUND%d", len(winners)-i, len(winners)-i-1); summary.ID != want {
+				t.Errorf("%s: match %d is %s, want %s", name, i, summary.ID, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import "math/rand"
+
+type TicTacToeState struct {
+	Board       [9]string
+	CurrentTurn string
+	GameActive  bool
+}
+
+type TicTacToeMovePayload struct {
+	Index    int    `json:"index"`
+	Player   string `json:"player"`
+	Username string `json:"username"`
+}
+
+func init() {
+	registerGame(GameTypeTicTacToe, func() Game {
+		return &TicTacToeState{
+			Board:       [9]string{},
+			CurrentTurn: "X",
+			GameActive:  true,
+		}
+	})
+}
+
+func (state *TicTacToeState) Roles() []string {
+	return []string{"X", "O"}
+}
+
+func (state *TicTacToeState) MoveTypes() []string {
+	return []string{"move"}
+}
+
+func (state *TicTacToeState) State() interface{} {
+	return struct {
+		Board       [9]string `json:"board"`
+		CurrentTurn string    `json:"currentTurn"`
+		GameActive  bool      `json:"gameActive"`
+	}{state.Board, state.CurrentTurn, state.GameActive}
+}
+
+func (state *TicTacToeState) IsOver() bool {
+	return !state.GameActive
+}
+
+func (state *TicTacToeState) Restart() {
+	*state = TicTacToeState{
+		Board:       [9]string{},
+		CurrentTurn: "X",
+		GameActive:  true,
+	}
+}
+
+func (state *TicTacToeState) Turn() string {
+	return state.CurrentTurn
+}
+
+func (state *TicTacToeState) SkipTurn() {
+	if state.CurrentTurn == "X" {
+		state.CurrentTurn = "O"
+	} else {
+		state.CurrentTurn = "X"
+	}
+}
+
+func (state *TicTacToeState) Stop() {
+	state.GameActive = false
+}
+
+func (state *TicTacToeState) ApplyMove(room *GameRoom, player *Player, msg Message) error {
+	var move struct {
+		Index  int    `json:"index"`
+		Player string `json:"player"`
+	}
+	if err := msg.decodePayload(&move); err != nil {
+		return errMalformedMove
+	}
+
+	if player.Role != state.CurrentTurn {
+		return errNotYourTurn
+	}
+
+	if move.Index < 0 || move.Index >= 9 {
+		return rejectMove(ErrInvalidMove, "Cell index must be between 0 and 8")
+	}
+
+	if state.Board[move.Index] != "" {
+		return rejectMove(ErrInvalidMove, "That cell is already taken")
+	}
+
+	state.Board[move.Index] = player.Role
+
+	if state.CurrentTurn == "X" {
+		state.CurrentTurn = "O"
+	} else {
+		state.CurrentTurn = "X"
+	}
+
+	room.sendAll(newMessage("move", TicTacToeMovePayload{
+		Index:    move.Index,
+		Player:   player.Role,
+		Username: player.Username,
+	}))
+
+	checkTicTacToeGameEnd(room, state)
+	return nil
+}
+
+var ticTacToeWinningCombos = [][3]int{
+	{0, 1, 2}, {3, 4, 5}, {6, 7, 8},
+	{0, 3, 6}, {1, 4, 7}, {2, 5, 8},
+	{0, 4, 8}, {2, 4, 6},
+}
+
+// ticTacToeWinner returns the role with three in a row, or "".
+func ticTacToeWinner(board *[9]string) string {
+	for _, combo := range ticTacToeWinningCombos {
+		a, b, c := combo[0], combo[1], combo[2]
+		if board[a] != "" && board[a] == board[b] && board[a] == board[c] {
+			return board[a]
+		}
+	}
+	return ""
+}
+
+func checkTicTacToeGameEnd(room *GameRoom, state *TicTacToeState) {
+	if winner := ticTacToeWinner(&state.Board); winner != "" {
+		state.GameActive = false
+		room.endGame(winner)
+		return
+	}
+
+	for _, cell := range state.Board {
+		if cell == "" {
+			return
+		}
+	}
+
+	state.GameActive = false
+	room.endGame("draw")
+}
+
+func (state *TicTacToeState) BotMove(role, level string) (Message, bool) {
+	if state.CurrentTurn != role {
+		return Message{}, false
+	}
+
+	var free []int
+	for i, cell := range state.Board {
+		if cell == "" {
+			free = append(free, i)
+		}
+	}
+	if len(free) == 0 {
+		return Message{}, false
+	}
+
+	index := free[rand.Intn(len(free))]
+	if level == BotHard || (level == BotMedium && rand.Intn(2) == 0) {
+		opponent := "X"
+		if role == "X" {
+			opponent = "O"
+		}
+
+		board := state.Board
+		best := -2
+		for _, i := range free {
+			board[i] = role
+			score := -ticTacToeNegamax(&board, opponent, role)
+			board[i] = ""
+			if score > best {
+				best, index = score, i
+			}
+		}
+	}
+
+	return newMessage("move", struct {
+		Index int `json:"index"`
+	}{index}), true
+}
+
+// ticTacToeNegamax scores board from the point of view of me, who moves next:
+// 1 for a forced win, 0 for a draw and -1 for a forced loss.
+func ticTacToeNegamax(board *[9]string, me, opponent string) int {
+	if ticTacToeWinner(board) != "" {
+		// The previous move won the game.
+		return -1
+	}
+
+	best := -2
+	for i, cell := range board {
+		if cell != "" {
+			continue
+		}
+		board[i] = me
+		score := -ticTacToeNegamax(board, opponent, me)
+		board[i] = ""
+		if score > best {
+			best = score
+		}
+		if best == 1 {
+			break
+		}
+	}
+
+	if best == -2 {
+		return 0
+	}
+	return best
+}
@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+
+// TestTicTacToeHardBotNeverLoses plays the hard bot against every possible
+// sequence of opponent moves, with the bot moving first and second.
+func TestTicTacToeHardBotNeverLoses(t *testing.T) {
+	for _, botRole := range []string{"X", "O"} {
+		t.Run("bot plays "+botRole, func(t *testing.T) {
+			state := TicTacToeState{CurrentTurn: "X", GameActive: true}
+			games, losses := playAllTicTacToe(t, state, botRole)
+			if losses > 0 {
+				t.Errorf("bot lost %d of %d games", losses, games)
+			}
+			if games == 0 {
+				t.Error("no games played")
+			}
+		})
+	}
+}
+
+// playAllTicTacToe plays out every game from state, returning how many were
+// played and how many the bot lost.
+func playAllTicTacToe(t *testing.T, state TicTacToeState, botRole string) (games, losses int) {
+	t.Helper()
+
+	if winner := ticTacToeWinner(&state.Board); winner != "" {
+		if winner != botRole {
+			t.Logf("bot lost: %v", state.Board)
+			return 1, 1
+		}
+		return 1, 0
+	}
+
+	var free []int
+	for i, cell := range state.Board {
+		if cell == "" {
+			free = append(free, i)
+		}
+	}
+	if len(free) == 0 {
+		return 1, 0
+	}
+
+	if state.CurrentTurn == botRole {
+		msg, ok := state.BotMove(botRole, BotHard)
+		if !ok {
+			t.Fatalf("bot did not move on %v", state.Board)
+		}
+		var move struct {
+			Index int `json:"index"`
+		}
+		if err := msg.decodePayload(&move); err != nil {
+			t.Fatal(err)
+		}
+		if state.Board[move.Index] != "" {
+			t.Fatalf("bot played taken cell %d on %v", move.Index, state.Board)
+		}
+		free = []int{move.Index}
+	}
+
+	for _, index := range free {
+		next := state
+		next.Board[index] = next.CurrentTurn
+		next.SkipTurn()
+		g, l := playAllTicTacToe(t, next, botRole)
+		games += g
+		losses += l
+	}
+	return games, losses
+}
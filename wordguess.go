@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+type WordGuessState struct {
+	Word            string
+	GuessedWord     []string
+	GuessedLetters  []string
+	WrongGuesses    int
+	MaxWrongGuesses int
+	GameActive      bool
+	CurrentTurn     string
+}
+
+type LetterGuessResultPayload struct {
+	Letter         string   `json:"letter"`
+	Found          bool     `json:"found"`
+	GuessedWord    []string `json:"guessedWord"`
+	GuessedLetters []string `json:"guessedLetters"`
+	WrongGuesses   int      `json:"wrongGuesses"`
+	GameActive     bool     `json:"gameActive"`
+	CurrentTurn    string   `json:"currentTurn"`
+	Word           string   `json:"word"`
+}
+
+var wordList = []string{
+	"JAVASCRIPT", "COMPUTER", "PROGRAMMING", "WEBSITE", "INTERNET", "KEYBOARD",
+	"MONITOR", "SOFTWARE", "HARDWARE", "DATABASE", "NETWORK", "SECURITY",
+	"ALGORITHM", "FUNCTION", "VARIABLE", "OBJECT", "ARRAY", "STRING",
+	"BOOLEAN", "INTEGER", "FRAMEWORK", "LIBRARY", "BROWSER", "SERVER",
+}
+
+func init() {
+	registerGame(GameTypeWordGuess, newWordGuessState)
+}
+
+func newWordGuessState() Game {
+	word := wordList[rand.Intn(len(wordList))]
+	guessedWord := make([]string, len(word))
+	for i := range guessedWord {
+		guessedWord[i] = "_"
+	}
+	return &WordGuessState{
+		Word:            word,
+		GuessedWord:     guessedWord,
+		GuessedLetters:  []string{},
+		WrongGuesses:    0,
+		MaxWrongGuesses: 6,
+		GameActive:      true,
+		CurrentTurn:     "P1",
+	}
+}
+
+func (state *WordGuessState) Roles() []string {
+	return []string{"P1", "P2"}
+}
+
+func (state *WordGuessState) MoveTypes() []string {
+	return []string{"letterGuess"}
+}
+
+func (state *WordGuessState) State() interface{} {
+	return struct {
+		GuessedWord     []string `json:"guessedWord"`
+		GuessedLetters  []string `json:"guessedLetters"`
+		WrongGuesses    int      `json:"wrongGuesses"`
+		MaxWrongGuesses int      `json:"maxWrongGuesses"`
+		GameActive      bool     `json:"gameActive"`
+		CurrentTurn     string   `json:"currentTurn"`
+	}{state.GuessedWord, state.GuessedLetters, state.WrongGuesses, state.MaxWrongGuesses, state.GameActive, state.CurrentTurn}
+}
+
+func (state *WordGuessState) IsOver() bool {
+	return !state.GameActive
+}
+
+func (state *WordGuessState) Restart() {
+	*state = *newWordGuessState().(*WordGuessState)
+}
+
+func (state *WordGuessState) Turn() string {
+	return state.CurrentTurn
+}
+
+func (state *WordGuessState) SkipTurn() {
+	if state.CurrentTurn == "P1" {
+		state.CurrentTurn = "P2"
+	} else {
+		state.CurrentTurn = "P1"
+	}
+}
+
+func (state *WordGuessState) Stop() {
+	state.GameActive = false
+}
+
+func (state *WordGuessState) ApplyMove(room *GameRoom, player *Player, msg Message) error {
+	var guess struct {
+		Letter string `json:"letter"`
+	}
+	if err := msg.decodePayload(&guess); err != nil {
+		return errMalformedMove
+	}
+
+	if player.Role != state.CurrentTurn {
+		return errNotYourTurn
+	}
+
+	letter := strings.ToUpper(guess.Letter)
+	if len(letter) != 1 || letter[0] < 'A' || letter[0] > 'Z' {
+		return rejectMove(ErrInvalidMove, "Guess must be a single letter from A to Z")
+	}
+
+	for _, l := range state.GuessedLetters {
+		if l == letter {
+			return rejectMove(ErrInvalidMove, fmt.Sprintf("%s has already been guessed", letter))
+		}
+	}
+
+	state.GuessedLetters = append(state.GuessedLetters, letter)
+
+	found := false
+	for i, char := range state.Word {
+		if string(char) == letter {
+			state.GuessedWord[i] = letter
+			found = true
+		}
+	}
+
+	if !found {
+		state.WrongGuesses++
+	}
+
+	wordComplete := true
+	for _, char := range state.GuessedWord {
+		if char == "_" {
+			wordComplete = false
+			break
+		}
+	}
+
+	if wordComplete {
+		state.GameActive = false
+	} else if state.WrongGuesses >= state.MaxWrongGuesses {
+		state.GameActive = false
+	} else {
+
+		if state.CurrentTurn == "P1" {
+			state.CurrentTurn = "P2"
+		} else {
+			state.CurrentTurn = "P1"
+		}
+	}
+
+	room.sendAll(newMessage("letterGuessResult", LetterGuessResultPayload{
+		Letter:         letter,
+		Found:          found,
+		GuessedWord:    state.GuessedWord,
+		GuessedLetters: state.GuessedLetters,
+		WrongGuesses:   state.WrongGuesses,
+		GameActive:     state.GameActive,
+		CurrentTurn:    state.CurrentTurn,
+		Word:           state.Word,
+	}))
+	if wordComplete {
+		room.gameFinished(player.Role, "")
+	} else if !state.GameActive {
+		room.gameFinished("draw", "")
+	}
+	return nil
+}